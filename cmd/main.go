@@ -18,9 +18,25 @@ const (
 
 func main() {
 	// 解析命令行参数
-	mode := flag.String("mode", "smart", "运行模式: smart(智能处理), notify(仅通知), cleanup(仅清理)")
+	mode := flag.String("mode", "smart", "运行模式: smart(智能处理), notify(仅通知), cleanup(仅清理), create(创建映射), renew(续期映射), restore(恢复已删除映射)")
 	configFile := flag.String("configs", "configs/config.yaml", "配置文件路径")
 	descFile := flag.String("desc", "configs/description.yaml", "描述映射文件路径")
+	acceptHostKey := flag.Bool("accept-host-key", false, "信任并记录首次连接的路由器主机密钥")
+	dryRun := flag.Bool("dry-run", false, "演练模式：读取条目并打印将要执行的命令和通知，不修改路由器，不发送通知")
+	inputFile := flag.String("input-file", "", "离线模式：读取保存的 display nat server 输出文件，不连接路由器")
+	recordFile := flag.String("record-deletions", "", "离线模式下将删除命令追加到该文件，未指定时离线模式只读")
+	asOf := flag.String("as-of", "", "按指定时间判断过期和提醒，如 \"2026-01-19 09:00\"，需与 --dry-run 一起使用")
+
+	// 映射操作参数
+	var mapping application.MappingOptions
+	flag.StringVar(&mapping.Router, "router", "", "路由器名称，只配置一个路由器时可省略")
+	flag.StringVar(&mapping.Interface, "interface", "", "配置映射的接口，如 GigabitEthernet0/0")
+	flag.StringVar(&mapping.Protocol, "protocol", "tcp", "协议: tcp/udp")
+	flag.StringVar(&mapping.Global, "global", "", "外网地址，IP:端口 或 IP:起始端口-结束端口")
+	flag.StringVar(&mapping.Local, "local", "", "内网地址，IP:端口 或 IP:起始端口-结束端口")
+	flag.StringVar(&mapping.Description, "description", "", "映射描述，vp= 过期标记会自动添加；带 ttl= 相对有效期时改为添加 ct= 创建日期")
+	flag.StringVar(&mapping.RunID, "run-id", "", "restore 模式按运行ID恢复该次运行删除的所有映射")
+	flag.StringVar(&mapping.Expire, "expire", "", "过期日期 YYMMDD 或 YYYY-MM-DD，create 默认按描述映射文件的 default_expiry_days，renew 必填，restore 时替换备份中的过期日期")
 	flag.Parse()
 
 	// 设置优雅关闭
@@ -33,28 +49,39 @@ func main() {
 
 	go func() {
 		sig := <-sigChan
-		log.Printf("收到信号 %v，开始优雅关闭...", sig)
+		log.Printf("收到信号 %v，开始优雅关闭，不再开始新的操作，等待进行中的修改完成（再次发送信号强制退出）...", sig)
 		cancel()
+
+		sig = <-sigChan
+		log.Printf("再次收到信号 %v，强制退出", sig)
+		os.Exit(ExitFailure)
 	}()
 
 	// 创建应用程序
 	app, err := application.NewApp(&application.Config{
-		Mode:       *mode,
-		ConfigFile: *configFile,
-		DescFile:   *descFile,
+		Mode:          *mode,
+		ConfigFile:    *configFile,
+		DescFile:      *descFile,
+		AcceptHostKey: *acceptHostKey,
+		DryRun:        *dryRun,
+		InputFile:     *inputFile,
+		RecordFile:    *recordFile,
+		AsOf:          *asOf,
+		Mapping:       mapping,
 	})
 	if err != nil {
 		log.Printf("创建应用程序失败: %v", err)
 		os.Exit(ExitFailure)
 	}
-	defer app.Close()
 
-	// 运行应用程序
-	if err := app.Run(ctx, *mode); err != nil {
+	// 运行应用程序，os.Exit 不执行 defer，退出前显式关闭连接
+	err = app.Run(ctx, *mode)
+	app.Close()
+	if err != nil {
 		log.Printf("程序执行失败: %v", err)
 		os.Exit(ExitFailure)
 	}
 
 	log.Println("程序执行完成")
 	os.Exit(ExitSuccess)
-}
\ No newline at end of file
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"h3c-nat-manager/internal/application/service"
+	"h3c-nat-manager/internal/domain/nat"
+	domainnotification "h3c-nat-manager/internal/domain/notification"
+	"h3c-nat-manager/internal/infrastructure/archive"
 	"h3c-nat-manager/internal/infrastructure/config"
 	"h3c-nat-manager/internal/infrastructure/description"
 	"h3c-nat-manager/internal/infrastructure/notification"
@@ -16,18 +20,34 @@ import (
 // App 应用程序结构
 type App struct {
 	natManager *service.NATManagerService
-	h3cClient  *router.H3CClient
+	clients    []router.Client
+	mapping    MappingOptions
+	deadline   time.Duration // 整次运行的时限
 }
 
 // Config 应用配置
 type Config struct {
-	Mode       string
-	ConfigFile string
-	DescFile   string
+	Mode          string
+	ConfigFile    string
+	DescFile      string
+	AcceptHostKey bool           // 信任首次连接的路由器主机密钥
+	DryRun        bool           // 演练模式，只打印命令和通知
+	InputFile     string         // 离线模式读取的 display nat server 输出文件
+	RecordFile    string         // 离线模式记录删除命令的文件，为空时只读
+	AsOf          string         // 演练模式下按该时间判断过期，为空时使用当前时间
+	Mapping       MappingOptions // create 等映射操作模式的参数
 }
 
 // NewApp 创建应用程序实例
 func NewApp(cfg *Config) (*App, error) {
+	// 先按系统时区检查格式，日期时间在创建各路由器时按其时区解析
+	if _, err := parseAsOf(cfg.AsOf, time.Local); err != nil {
+		return nil, err
+	}
+	if cfg.AsOf != "" && !cfg.DryRun {
+		return nil, fmt.Errorf("--as-of 只能与 --dry-run 一起使用")
+	}
+
 	// 加载配置
 	appConfig, err := config.LoadConfig(cfg.ConfigFile)
 	if err != nil {
@@ -35,44 +55,148 @@ func NewApp(cfg *Config) (*App, error) {
 	}
 	log.Println("配置文件加载成功")
 
-	// 创建描述映射器
+	// 创建描述映射器，映射文件可选，缺失时直接使用路由器上的描述
 	descMapper := description.NewMapper()
 	if err := descMapper.LoadMappings(cfg.DescFile); err != nil {
-		return nil, fmt.Errorf("加载描述映射失败: %v", err)
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("加载描述映射失败: %v", err)
+		}
+		log.Printf("未找到描述映射文件 %s，使用路由器上的描述", cfg.DescFile)
+	} else {
+		log.Println("描述映射文件加载成功")
 	}
-	log.Println("描述映射文件加载成功")
 
-	// 创建H3C客户端
-	h3cClient := router.NewH3CClientWithExpiryTime(
-		appConfig.Router.Host,
-		appConfig.Router.User,
-		appConfig.Router.Passwd,
-		appConfig.Router.ExpiryTime.Hour,
-		appConfig.Router.ExpiryTime.Minute,
-	)
+	app := &App{mapping: cfg.Mapping, deadline: appConfig.Runtime.Deadline}
+	var targets []*service.RouterTarget
+	backupArchive := appConfig.Backup.Archive
+
+	if cfg.InputFile != "" {
+		// 离线模式只处理一个路由器，使用其过期时间和提醒配置，不连接路由器
+		routerConfig, err := offlineRouter(appConfig, cfg.Mapping.Router)
+		if err != nil {
+			return nil, err
+		}
+		clock, err := routerClock(cfg.AsOf, routerConfig)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, &service.RouterTarget{
+			Name:   routerConfig.Name,
+			Repo:   router.NewFileRepository(cfg.InputFile, cfg.RecordFile, routerConfig, clock, cfg.DryRun),
+			Config: routerConfig,
+			Clock:  clock,
+		})
+		// 离线删除的备份与删除记录放在一起，避免混入生产路由器的备份归档
+		if cfg.RecordFile != "" {
+			backupArchive = cfg.RecordFile + ".backup.jsonl"
+		}
+		log.Printf("离线模式: 读取 %s，路由器配置: %s", cfg.InputFile, routerConfig.Name)
+	} else {
+		// 为每个路由器按配置的 backend 创建CLI或NETCONF客户端
+		for i := range appConfig.Routers {
+			routerConfig := &appConfig.Routers[i]
+			clock, err := routerClock(cfg.AsOf, routerConfig)
+			if err != nil {
+				app.Close()
+				return nil, err
+			}
+			client, err := router.NewClient(routerConfig, router.ClientOptions{
+				AcceptHostKey:  cfg.AcceptHostKey,
+				DryRun:         cfg.DryRun,
+				ConnectTimeout: appConfig.Runtime.ConnectTimeout,
+				CommandTimeout: appConfig.Runtime.CommandTimeout,
+				MaxSessions:    appConfig.Runtime.RouterConcurrency,
+			})
+			if err != nil {
+				app.Close()
+				return nil, fmt.Errorf("创建路由器 '%s' 客户端失败: %v", routerConfig.Name, err)
+			}
+			app.clients = append(app.clients, client)
+			targets = append(targets, &service.RouterTarget{
+				Name:   routerConfig.Name,
+				Repo:   client,
+				Config: routerConfig,
+				Clock:  clock,
+			})
+		}
+	}
 
-	// 创建钉钉通知服务
-	dingTalkSvc := notification.NewDingTalkService(&appConfig.DingTalk)
+	// 创建钉钉通知服务，演练模式只打印通知
+	dingTalk := notification.NewDingTalkService(&appConfig.DingTalk)
+	dingTalk.SetTimeout(appConfig.Runtime.NotifyTimeout)
+	var notificationSvc domainnotification.Service = dingTalk
+	if cfg.DryRun {
+		notificationSvc = notification.NewDryRunService(&appConfig.DingTalk)
+	}
 
 	// 创建NAT管理服务
-	natManager := service.NewNATManagerService(
-		h3cClient,
-		dingTalkSvc,
+	app.natManager = service.NewNATManagerService(
+		targets,
+		notificationSvc,
 		descMapper,
+		archive.NewFileArchive(backupArchive),
 		appConfig,
+		cfg.DryRun,
 	)
+	if cfg.AsOf != "" {
+		log.Printf("按指定时间 %s 判断过期和提醒，未带时区偏移时按各路由器的时区解析", cfg.AsOf)
+	}
+
+	return app, nil
+}
 
-	return &App{
-		natManager: natManager,
-		h3cClient:  h3cClient,
-	}, nil
+// asOfLayouts --as-of 支持的时间格式，只有日期时为当天0点；
+// 带时区偏移（如 2026-01-19T09:00+08:00）时为确定的时刻，与路由器时区无关
+var asOfLayouts = []string{
+	"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02",
+	"2006-01-02 15:04Z07:00", "2006-01-02T15:04Z07:00", "2006-01-02 15:04:05Z07:00", time.RFC3339,
+}
+
+// parseAsOf 解析 --as-of 参数，没有时区偏移时按loc时区解析，为空时返回零值
+func parseAsOf(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range asOfLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的时间 --as-of: %s，格式为 YYYY-MM-DD 或 YYYY-MM-DD HH:MM，可带时区偏移如 +08:00", value)
+}
+
+// routerClock 返回路由器判断过期使用的时钟，指定 --as-of 时按路由器配置的时区解析
+func routerClock(asOf string, routerConfig *config.RouterConfig) (nat.Clock, error) {
+	if asOf == "" {
+		return nat.SystemClock{}, nil
+	}
+	t, err := parseAsOf(asOf, routerConfig.Location())
+	if err != nil {
+		return nil, err
+	}
+	return nat.FixedClock(t), nil
+}
+
+// offlineRouter 选择离线模式使用的路由器配置，只配置了一个路由器时名称可以为空
+func offlineRouter(appConfig *config.Config, name string) (*config.RouterConfig, error) {
+	if name == "" {
+		if len(appConfig.Routers) == 1 {
+			return &appConfig.Routers[0], nil
+		}
+		return nil, fmt.Errorf("配置了多个路由器，离线模式请使用 --router 指定使用哪个路由器的配置")
+	}
+	for i := range appConfig.Routers {
+		if appConfig.Routers[i].Name == name {
+			return &appConfig.Routers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("未找到路由器: %s", name)
 }
 
 // Run 运行应用程序
 func (a *App) Run(ctx context.Context, mode string) error {
-	// 创建带超时的上下文
-	const shutdownTimeout = 30 * time.Second
-	timeoutCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	// 整次运行受 runtime.deadline 限制
+	timeoutCtx, cancel := context.WithTimeout(ctx, a.deadline)
 	defer cancel()
 
 	// 根据模式执行相应操作
@@ -86,6 +210,15 @@ func (a *App) Run(ctx context.Context, mode string) error {
 	case "cleanup":
 		log.Println("执行清理模式...")
 		return a.executeWithContext(timeoutCtx, a.natManager.CleanupExpired)
+	case "create":
+		log.Println("执行创建映射模式...")
+		return a.executeWithContext(timeoutCtx, a.createMapping)
+	case "renew":
+		log.Println("执行续期模式...")
+		return a.executeWithContext(timeoutCtx, a.renewMapping)
+	case "restore":
+		log.Println("执行恢复模式...")
+		return a.executeWithContext(timeoutCtx, a.restoreMappings)
 	default:
 		return fmt.Errorf("无效的运行模式: %s", mode)
 	}
@@ -93,23 +226,25 @@ func (a *App) Run(ctx context.Context, mode string) error {
 
 // Close 关闭应用程序资源
 func (a *App) Close() {
-	if a.h3cClient != nil {
-		a.h3cClient.Close()
+	for _, client := range a.clients {
+		client.Close()
 	}
 }
 
-// executeWithContext 在上下文中执行函数
-func (a *App) executeWithContext(ctx context.Context, fn func() error) error {
+// executeWithContext 在上下文中执行函数。ctx取消后fn不再开始新的操作，
+// 这里等待fn中已开始的路由器修改完成后再返回，避免进程在修改中途退出
+func (a *App) executeWithContext(ctx context.Context, fn func(ctx context.Context) error) error {
 	done := make(chan error, 1)
 
 	go func() {
-		done <- fn()
+		done <- fn(ctx)
 	}()
 
 	select {
 	case err := <-done:
 		return err
 	case <-ctx.Done():
-		return ctx.Err()
+		log.Printf("运行被中断(%v)，等待进行中的路由器修改完成...", ctx.Err())
+		return <-done
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,66 @@
+package application
+
+import (
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+func TestRouterClockUsesRouterTimezone(t *testing.T) {
+	shanghai := &config.RouterConfig{Name: "sh", Timezone: "Asia/Shanghai"}
+	utc := &config.RouterConfig{Name: "utc", Timezone: "UTC"}
+
+	tests := []struct {
+		asOf      string
+		shanghai  string // 上海路由器时钟的UTC时间
+		utc       string // UTC路由器时钟的UTC时间
+		sameClock bool
+	}{
+		// 不带时区偏移时按各路由器的时区解析，表示各自当地的同一钟点
+		{"2026-01-19 09:00", "2026-01-19 01:00", "2026-01-19 09:00", false},
+		{"2026-01-19", "2026-01-18 16:00", "2026-01-19 00:00", false},
+		// 带时区偏移时是同一时刻
+		{"2026-01-19T09:00+08:00", "2026-01-19 01:00", "2026-01-19 01:00", true},
+		{"2026-01-19 09:00:00Z", "2026-01-19 09:00", "2026-01-19 09:00", true},
+	}
+
+	for _, tt := range tests {
+		shClock, err := routerClock(tt.asOf, shanghai)
+		if err != nil {
+			t.Fatalf("routerClock(%q) = %v", tt.asOf, err)
+		}
+		utcClock, err := routerClock(tt.asOf, utc)
+		if err != nil {
+			t.Fatalf("routerClock(%q) = %v", tt.asOf, err)
+		}
+
+		if got := shClock.Now().UTC().Format("2006-01-02 15:04"); got != tt.shanghai {
+			t.Errorf("%s: 上海路由器的时间 = %s UTC, 期望 %s UTC", tt.asOf, got, tt.shanghai)
+		}
+		if got := utcClock.Now().UTC().Format("2006-01-02 15:04"); got != tt.utc {
+			t.Errorf("%s: UTC路由器的时间 = %s UTC, 期望 %s UTC", tt.asOf, got, tt.utc)
+		}
+		if same := shClock.Now().Equal(utcClock.Now()); same != tt.sameClock {
+			t.Errorf("%s: 两个路由器是否为同一时刻 = %v, 期望 %v", tt.asOf, same, tt.sameClock)
+		}
+	}
+}
+
+func TestRouterClockWithoutAsOf(t *testing.T) {
+	clock, err := routerClock("", &config.RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(clock.Now()) > time.Minute {
+		t.Errorf("未指定 --as-of 时应使用系统时钟, Now() = %v", clock.Now())
+	}
+}
+
+func TestParseAsOfInvalid(t *testing.T) {
+	for _, value := range []string{"2026/01/19", "2026-01-19 09:00 +0800", "tomorrow"} {
+		if _, err := parseAsOf(value, time.UTC); err == nil {
+			t.Errorf("parseAsOf(%q) 应返回错误", value)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// MappingOptions 映射操作模式的命令行参数
+type MappingOptions struct {
+	Router      string // 路由器名称，只有一个路由器时可为空
+	Interface   string // 配置映射的接口
+	Protocol    string // tcp/udp
+	Global      string // 外网地址 IP:端口 或 IP:起始端口-结束端口
+	Local       string // 内网地址 IP:端口 或 IP:起始端口-结束端口
+	Description string // 描述，vp= 标记由工具自动添加，带 ttl= 时改为添加 ct= 创建日期
+	Expire      string // 过期日期 YYMMDD 或 YYYY-MM-DD，create 为空时使用默认有效天数，restore 为空时原样恢复
+	RunID       string // restore 模式按运行ID恢复
+}
+
+// createMapping 按命令行参数创建映射
+func (a *App) createMapping(ctx context.Context) error {
+	opts := a.mapping
+
+	entry := &nat.NATEntry{
+		Interface:   opts.Interface,
+		Protocol:    strings.ToUpper(opts.Protocol),
+		Description: opts.Description,
+	}
+
+	var err error
+	entry.GlobalIP, entry.GlobalPort, entry.GlobalPortEnd, err = parseEndpoint(opts.Global)
+	if err != nil {
+		return fmt.Errorf("无效的外网地址 --global: %v", err)
+	}
+	entry.LocalIP, entry.LocalPort, entry.LocalPortEnd, err = parseEndpoint(opts.Local)
+	if err != nil {
+		return fmt.Errorf("无效的内网地址 --local: %v", err)
+	}
+
+	expiry, err := parseExpireDate(opts.Expire)
+	if err != nil {
+		return err
+	}
+
+	return a.natManager.CreateMapping(ctx, opts.Router, entry, expiry)
+}
+
+// renewMapping 按命令行参数续期映射
+func (a *App) renewMapping(ctx context.Context) error {
+	opts := a.mapping
+	if opts.Global == "" {
+		return fmt.Errorf("续期需要使用 --global 指定外网地址端口")
+	}
+	if opts.Expire == "" {
+		return fmt.Errorf("续期需要使用 --expire 指定新的过期日期")
+	}
+
+	expiry, err := parseExpireDate(opts.Expire)
+	if err != nil {
+		return err
+	}
+
+	return a.natManager.RenewMapping(ctx, opts.Router, opts.Global, opts.Protocol, expiry)
+}
+
+// restoreMappings 按命令行参数从备份归档恢复映射，指定 --expire 时同时续期
+func (a *App) restoreMappings(ctx context.Context) error {
+	expiry, err := parseExpireDate(a.mapping.Expire)
+	if err != nil {
+		return err
+	}
+	return a.natManager.RestoreMappings(ctx, a.mapping.Router, a.mapping.Global, a.mapping.RunID, expiry)
+}
+
+// parseEndpoint 解析 IP:端口 或 IP:起始端口-结束端口
+func parseEndpoint(value string) (string, int, int, error) {
+	host, portPart, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	start, end, isRange := strings.Cut(portPart, "-")
+	port, err := strconv.Atoi(start)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("无效的端口: %s", start)
+	}
+
+	portEnd := 0
+	if isRange {
+		portEnd, err = strconv.Atoi(end)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("无效的端口: %s", end)
+		}
+	}
+	return host, port, portEnd, nil
+}
+
+// parseExpireDate 解析 --expire 参数，为空时返回零值
+func parseExpireDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"060102", time.DateOnly} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的过期日期 --expire: %s，格式为 YYMMDD 或 YYYY-MM-DD", value)
+}
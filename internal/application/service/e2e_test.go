@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/domain/notification"
+	"h3c-nat-manager/internal/infrastructure/archive"
+	"h3c-nat-manager/internal/infrastructure/config"
+	"h3c-nat-manager/internal/infrastructure/description"
+	"h3c-nat-manager/internal/infrastructure/router"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+// recordingNotifier 记录发送的通知，不连接钉钉；与webhook一样，ctx已取消时发送失败
+type recordingNotifier struct {
+	mu       sync.Mutex
+	expiry   []*notification.ExpiryNotification
+	deletion []*notification.DeletionNotification
+	renewal  []*notification.RenewalNotification
+	invalid  []*notification.InvalidTagNotification
+}
+
+func (r *recordingNotifier) SendNotification(ctx context.Context, n *notification.ExpiryNotification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expiry = append(r.expiry, n)
+	return nil
+}
+
+func (r *recordingNotifier) SendDeletionNotification(ctx context.Context, n *notification.DeletionNotification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deletion = append(r.deletion, n)
+	return nil
+}
+
+func (r *recordingNotifier) SendRenewalNotification(ctx context.Context, n *notification.RenewalNotification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renewal = append(r.renewal, n)
+	return nil
+}
+
+func (r *recordingNotifier) SendInvalidTagNotification(ctx context.Context, n *notification.InvalidTagNotification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invalid = append(r.invalid, n)
+	return nil
+}
+
+// testEnv 连接到模拟器的NAT管理服务
+type testEnv struct {
+	sim      *simulator.Server
+	svc      *NATManagerService
+	notifier *recordingNotifier
+	archive  *archive.FileArchive
+}
+
+// 相对当前日期的过期标记，保证测试数据不随日期失效
+var (
+	expiredTag  = "vp=" + time.Now().AddDate(0, 0, -2).Format("060102")
+	expiringTag = "vp=" + time.Now().AddDate(0, 0, 3).Format("060102")
+	laterTag    = "vp=" + time.Now().AddDate(0, 0, 100).Format("060102")
+)
+
+// newTestEnv 启动模拟器并写入以下映射：已过期、即将过期、远期过期、没有过期标记各一条
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newTestEnvWithBackend(t, config.BackendCLI)
+}
+
+// newTestEnvWithBackend 与 newTestEnv 相同，使用指定的路由器访问方式
+func newTestEnvWithBackend(t *testing.T, backend string) *testEnv {
+	t.Helper()
+
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	seed := []string{
+		"nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description expired-web " + expiredTag,
+		"nat server protocol tcp global 117.149.14.2 54188 inside 192.168.1.109 22 description soon-ssh " + expiringTag,
+		"nat server protocol udp global 117.149.14.2 52183 inside 192.168.1.112 1883 description mqtt " + laterTag,
+		"nat server protocol tcp global 117.149.14.2 8443 inside 192.168.1.90 443 description dashboard",
+	}
+	for _, line := range seed {
+		if err := sim.AddMapping("GigabitEthernet0/0", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	routerConfig := &config.RouterConfig{
+		SSHAuthConfig:            config.SSHAuthConfig{User: "admin", Passwd: "secret"},
+		Name:                     "sim",
+		Host:                     sim.Host(),
+		Port:                     sim.Port(),
+		ReminderBeforeExpiration: 10,
+		ExpiryTime:               config.ExpiryTimeConfig{Hour: 21, Minute: 30},
+		HostKeyFingerprint:       sim.Fingerprint(),
+		SaveAfterChanges:         true,
+		Backend:                  backend,
+		NetconfPort:              sim.Port(),
+	}
+	client, err := router.NewClient(routerConfig, router.ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	env := &testEnv{
+		sim:      sim,
+		notifier: &recordingNotifier{},
+		archive:  archive.NewFileArchive(filepath.Join(t.TempDir(), "nat_backup.jsonl")),
+	}
+	env.svc = NewNATManagerService(
+		[]*RouterTarget{{Name: routerConfig.Name, Repo: client, Config: routerConfig}},
+		env.notifier,
+		description.NewMapper(),
+		env.archive,
+		&config.Config{Routers: []config.RouterConfig{*routerConfig}},
+		false,
+	)
+	return env
+}
+
+// hasMapping 判断模拟器的NAT表中是否还有该外网端口的映射
+func (e *testEnv) hasMapping(globalPort string) bool {
+	for _, m := range e.sim.Mappings() {
+		if strings.Contains(m.Line, "global 117.149.14.2 "+globalPort+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCommand 判断模拟器是否收到过以prefix开头的命令
+func (e *testEnv) hasCommand(prefix string) bool {
+	for _, cmd := range e.sim.Commands() {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSmartProcessE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := env.svc.SmartProcess(context.Background()); err != nil {
+		t.Fatalf("SmartProcess() = %v", err)
+	}
+
+	if env.hasMapping("7935") {
+		t.Error("已过期的映射没有被删除")
+	}
+	for _, port := range []string{"54188", "52183", "8443"} {
+		if !env.hasMapping(port) {
+			t.Errorf("未过期的映射 %s 被删除", port)
+		}
+	}
+
+	if len(env.notifier.expiry) != 1 || env.notifier.expiry[0].GlobalAddress != "117.149.14.2:54188" {
+		t.Errorf("过期提醒 = %+v, 期望只提醒 117.149.14.2:54188", env.notifier.expiry)
+	}
+	if len(env.notifier.deletion) != 1 || env.notifier.deletion[0].GlobalAddress != "117.149.14.2:7935" {
+		t.Errorf("删除通知 = %+v, 期望只通知 117.149.14.2:7935", env.notifier.deletion)
+	}
+	if got := env.notifier.deletion[0].Source; got != "sim" {
+		t.Errorf("删除通知的消息来源 = %q, 期望 %q", got, "sim")
+	}
+
+	if got := env.sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 期望 1", got)
+	}
+
+	records, err := env.archive.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !strings.HasPrefix(records[0].ConfigLine, "nat server protocol tcp global 117.149.14.2 7935 ") {
+		t.Errorf("备份记录 = %+v, 期望备份 7935 的原始配置行", records)
+	}
+}
+
+func TestSmartProcessNetconfE2E(t *testing.T) {
+	env := newTestEnvWithBackend(t, config.BackendNetconf)
+
+	if err := env.svc.SmartProcess(context.Background()); err != nil {
+		t.Fatalf("SmartProcess() = %v", err)
+	}
+
+	if env.hasMapping("7935") || len(env.sim.Mappings()) != 3 {
+		t.Errorf("NAT表 = %+v, 期望只删除 7935", env.sim.Mappings())
+	}
+	if !env.hasCommand("netconf edit-config remove") || env.hasCommand("undo nat server") {
+		t.Errorf("应通过NETCONF删除: %v", env.sim.Commands())
+	}
+	if len(env.notifier.expiry) != 1 || len(env.notifier.deletion) != 1 {
+		t.Errorf("过期提醒 %d 条、删除通知 %d 条, 期望各 1 条", len(env.notifier.expiry), len(env.notifier.deletion))
+	}
+	if got := env.sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 期望 1", got)
+	}
+
+	records, err := env.archive.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !strings.HasPrefix(records[0].ConfigLine, "nat server protocol tcp global 117.149.14.2 7935 ") {
+		t.Errorf("备份记录 = %+v, 期望备份 7935 的配置行", records)
+	}
+}
+
+func TestSmartProcessInvalidTagE2E(t *testing.T) {
+	env := newTestEnv(t)
+	for _, line := range []string{
+		"nat server protocol tcp global 117.149.14.2 9001 inside 192.168.1.20 80 description typo own=zhangsan grp=inspection vp=261345",
+		"nat server protocol tcp global 117.149.14.2 9002 inside 192.168.1.20 81 description short vp=2601",
+		"nat server protocol tcp global 117.149.14.2 9003 inside 192.168.1.20 82 description empty vp=",
+		"nat server protocol tcp global 117.149.14.2 9004 inside 192.168.1.20 83 description spaced vp= 260112",
+	} {
+		if err := env.sim.AddMapping("GigabitEthernet0/0", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := env.svc.SmartProcess(context.Background()); err != nil {
+		t.Fatalf("SmartProcess() = %v", err)
+	}
+
+	for _, port := range []string{"9001", "9002", "9003", "9004"} {
+		if !env.hasMapping(port) {
+			t.Errorf("标记无效的映射 %s 不应被删除", port)
+		}
+	}
+	if len(env.notifier.invalid) != 4 {
+		t.Fatalf("标记无效提醒 = %+v, 期望 4 条", env.notifier.invalid)
+	}
+	reasons := map[string]string{}
+	for _, n := range env.notifier.invalid {
+		reasons[n.GlobalAddress] = n.Reason
+		if n.GlobalAddress == "117.149.14.2:9001" && (n.Owner != "zhangsan" || n.Group != "inspection") {
+			t.Errorf("标记无效提醒 = %+v", n)
+		}
+	}
+	for addr, want := range map[string]string{
+		"117.149.14.2:9001": "vp=261345 日期不存在",
+		"117.149.14.2:9003": "vp= 缺少日期",
+		"117.149.14.2:9004": "vp= 与日期 260112 之间不能有空格",
+	} {
+		if reasons[addr] != want {
+			t.Errorf("%s 的无效原因 = %q, 期望 %q", addr, reasons[addr], want)
+		}
+	}
+	if len(env.notifier.expiry) != 1 || len(env.notifier.deletion) != 1 {
+		t.Errorf("过期提醒 %d 条、删除通知 %d 条, 期望各 1 条", len(env.notifier.expiry), len(env.notifier.deletion))
+	}
+}
+
+func TestSmartProcessAsOfE2E(t *testing.T) {
+	asOf := nat.FixedClock(time.Now().AddDate(0, 0, 5))
+	for name, setClock := range map[string]func(env *testEnv){
+		"服务时钟": func(env *testEnv) { env.svc.SetClock(asOf) },
+		// --as-of 按各路由器的时区解析，路由器自己的时钟优先于服务时钟
+		"路由器时钟": func(env *testEnv) { env.svc.routers[0].Clock = asOf },
+	} {
+		env := newTestEnv(t)
+		// 5天后即将过期的 54188 已过期，100天后过期的 52183 进入10天提醒范围之前仍不提醒
+		setClock(env)
+
+		if err := env.svc.SmartProcess(context.Background()); err != nil {
+			t.Fatalf("%s: SmartProcess() = %v", name, err)
+		}
+
+		if env.hasMapping("7935") || env.hasMapping("54188") {
+			t.Errorf("%s: 按指定时间已过期的映射没有被删除: %+v", name, env.sim.Mappings())
+		}
+		if !env.hasMapping("52183") || !env.hasMapping("8443") {
+			t.Errorf("%s: 未过期的映射被删除: %+v", name, env.sim.Mappings())
+		}
+		if len(env.notifier.expiry) != 0 || len(env.notifier.deletion) != 2 {
+			t.Errorf("%s: 过期提醒 %d 条、删除通知 %d 条, 期望 0 条和 2 条", name, len(env.notifier.expiry), len(env.notifier.deletion))
+		}
+	}
+}
+
+func TestCheckAndNotifyE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := env.svc.CheckAndNotify(context.Background()); err != nil {
+		t.Fatalf("CheckAndNotify() = %v", err)
+	}
+
+	if len(env.sim.Mappings()) != 4 {
+		t.Errorf("通知模式修改了NAT表: %+v", env.sim.Mappings())
+	}
+	if env.hasCommand("system-view") || env.hasCommand("save") {
+		t.Errorf("通知模式不应发送配置命令: %v", env.sim.Commands())
+	}
+
+	if len(env.notifier.expiry) != 1 || env.notifier.expiry[0].GlobalAddress != "117.149.14.2:54188" {
+		t.Errorf("过期提醒 = %+v, 期望只提醒 117.149.14.2:54188", env.notifier.expiry)
+	}
+	if len(env.notifier.deletion) != 0 {
+		t.Errorf("通知模式不应发送删除通知: %+v", env.notifier.deletion)
+	}
+}
+
+func TestCleanupExpiredE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := env.svc.CleanupExpired(context.Background()); err != nil {
+		t.Fatalf("CleanupExpired() = %v", err)
+	}
+
+	if env.hasMapping("7935") {
+		t.Error("已过期的映射没有被删除")
+	}
+	if len(env.sim.Mappings()) != 3 {
+		t.Errorf("NAT表条目数 = %d, 期望 3", len(env.sim.Mappings()))
+	}
+	if !env.hasCommand("undo nat server protocol tcp global 117.149.14.2 7935") {
+		t.Errorf("没有发送删除命令: %v", env.sim.Commands())
+	}
+
+	if len(env.notifier.expiry) != 0 {
+		t.Errorf("清理模式不应发送过期提醒: %+v", env.notifier.expiry)
+	}
+	if len(env.notifier.deletion) != 1 {
+		t.Errorf("删除通知数量 = %d, 期望 1", len(env.notifier.deletion))
+	}
+}
+
+func TestCleanupExpiredUnverifiedE2E(t *testing.T) {
+	env := newTestEnv(t)
+	env.sim.IgnoreCommand("undo nat server")
+
+	if err := env.svc.CleanupExpired(context.Background()); err == nil {
+		t.Fatal("删除未生效时 CleanupExpired() 应返回错误")
+	}
+
+	if !env.hasMapping("7935") {
+		t.Error("模拟器忽略了删除命令，映射应仍然存在")
+	}
+	if len(env.notifier.deletion) != 0 {
+		t.Errorf("删除未确认时不应发送删除通知: %+v", env.notifier.deletion)
+	}
+}
+
+func TestCleanupExpiredCommandErrorE2E(t *testing.T) {
+	env := newTestEnv(t)
+	env.sim.FailCommand("undo nat server", " % The system is busy, please try again later.")
+
+	if err := env.svc.CleanupExpired(context.Background()); err == nil {
+		t.Fatal("删除命令出错时 CleanupExpired() 应返回错误")
+	}
+
+	if !env.hasMapping("7935") {
+		t.Error("删除失败时映射应仍然存在")
+	}
+	if len(env.notifier.deletion) != 0 {
+		t.Errorf("删除失败时不应发送删除通知: %+v", env.notifier.deletion)
+	}
+	if got := env.sim.SaveCount(); got != 0 {
+		t.Errorf("没有成功的修改时不应保存，保存次数 = %d", got)
+	}
+}
+
+// cancelOnDelete 第一次删除时取消运行的上下文，模拟删除过程中收到退出信号
+type cancelOnDelete struct {
+	nat.Repository
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnDelete) DeleteEntry(ctx context.Context, entry *nat.NATEntry) error {
+	c.cancel()
+	return c.Repository.DeleteEntry(ctx, entry)
+}
+
+func TestCleanupExpiredCancelledE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	target := env.svc.routers[0]
+	target.Repo = &cancelOnDelete{Repository: target.Repo, cancel: cancel}
+
+	err := env.svc.CleanupExpired(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CleanupExpired() = %v, 期望 context.Canceled", err)
+	}
+
+	// 删除开始后收到取消，删除仍执行完毕并保存
+	if env.hasMapping("7935") {
+		t.Error("已开始的删除被取消中断")
+	}
+	if got := env.sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 期望已完成的删除被保存", got)
+	}
+	// 已确认删除的映射在取消后仍发送删除通知，之后的运行不会再补发
+	if len(env.notifier.deletion) != 1 || env.notifier.deletion[0].GlobalAddress != "117.149.14.2:7935" {
+		t.Errorf("删除通知 = %+v, 期望已删除的 7935 收到通知", env.notifier.deletion)
+	}
+
+	// 已取消的运行不再向路由器发送任何命令
+	sent := len(env.sim.Commands())
+	if err := env.svc.CleanupExpired(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后 CleanupExpired() = %v, 期望 context.Canceled", err)
+	}
+	if got := len(env.sim.Commands()); got != sent {
+		t.Errorf("取消后仍发送了命令: %v", env.sim.Commands()[sent:])
+	}
+}
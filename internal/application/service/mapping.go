@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/domain/notification"
+)
+
+// defaultExpiryDays 描述映射文件未配置 default_expiry_days 时新建映射的有效天数
+const defaultExpiryDays = 365
+
+// CreateMapping 在指定路由器上创建NAT映射，expiry为零值时按默认有效天数计算
+func (s *NATManagerService) CreateMapping(ctx context.Context, routerName string, entry *nat.NATEntry, expiry time.Time) error {
+	target, err := s.findRouter(routerName)
+	if err != nil {
+		return err
+	}
+	entry.Router = target.Name
+	loc := target.Config.Location()
+	now := s.routerNow(target)
+
+	meta := nat.ParseMetadata(entry.Description)
+	if expiry.IsZero() && meta.Expiry == "" && meta.TTL != "" {
+		// 描述中使用 ttl= 相对有效期时记录创建日期，过期时间由 ttl= 计算
+		if meta.Created == "" {
+			entry.Description += " " + nat.FormatCreatedTag(now)
+		}
+	} else {
+		if expiry.IsZero() {
+			days := s.descMapper.DefaultExpiryDays()
+			if days <= 0 {
+				days = defaultExpiryDays
+			}
+			expiry = now.AddDate(0, 0, days)
+		}
+
+		// 过期标记是必填项，统一由工具写入
+		entry.Description = nat.WithExpiryTag(entry.Description, expiry)
+	}
+	if err := entry.ParseDescription(target.Config.ExpiryTime.Hour, target.Config.ExpiryTime.Minute, loc); err != nil {
+		return fmt.Errorf("解析过期时间失败: %v", err)
+	}
+	if !entry.ExpiryDate.After(now) {
+		return fmt.Errorf("过期时间必须晚于当前时间: %s", entry.ExpiryDate.Format(time.DateTime))
+	}
+
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("映射参数无效: %v", err)
+	}
+
+	// 检查外网端口是否已被占用
+	existing, err := target.Repo.GetAllEntries(ctx)
+	if err != nil {
+		return fmt.Errorf("获取NAT条目失败: %v", err)
+	}
+	for _, other := range existing {
+		if entry.ConflictsWith(other) {
+			return fmt.Errorf("外网地址端口冲突: %s (%s) 已映射到 %s，接口 %s",
+				other.GetGlobalAddress(), other.Protocol, other.GetLocalAddress(), other.Interface)
+		}
+	}
+
+	changeCtx, err := changeContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := target.Repo.CreateEntry(changeCtx, entry); err != nil {
+		return fmt.Errorf("创建映射失败 - %s -> %s (%s): %w",
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, err)
+	}
+
+	log.Printf("[%s] 已创建映射 - %s -> %s (%s), 描述: %s, 过期时间: %s", target.Name,
+		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol,
+		entry.Description, entry.ExpiryDate.Format(time.DateTime))
+
+	_, err = s.saveIfChanged(ctx, target, 1)
+	return err
+}
+
+// RenewMapping 将指定外网地址端口的映射续期到新的过期日期，并通知所属群组
+func (s *NATManagerService) RenewMapping(ctx context.Context, routerName, globalAddress, protocol string, expiry time.Time) error {
+	target, err := s.findRouter(routerName)
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.findEntry(ctx, target, globalAddress, protocol)
+	if err != nil {
+		return err
+	}
+	if !entry.HasExpiryInfo() {
+		return fmt.Errorf("映射 %s 没有 vp= 或 ttl= 过期标记，不会过期，不需要续期", globalAddress)
+	}
+	// 原标记无效时没有原过期时间，续期会写入有效的标记
+	var oldExpiry time.Time
+	if entry.ExpiryDate != nil {
+		oldExpiry = *entry.ExpiryDate
+	}
+
+	// 续期后的过期时间与创建时一样必须晚于路由器的当前时间，否则下次运行会直接删除
+	expected, err := expectedRenewal(target, entry, expiry)
+	if err != nil {
+		return err
+	}
+	if !expected.ExpiryDate.After(s.routerNow(target)) {
+		return fmt.Errorf("续期后的过期时间必须晚于当前时间: %s", expected.ExpiryDate.Format(time.DateTime))
+	}
+
+	changeCtx, err := changeContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := target.Repo.RenewEntry(changeCtx, entry, expiry); err != nil {
+		return fmt.Errorf("续期映射失败 - %s -> %s (%s): %w",
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, err)
+	}
+
+	renewed, err := s.confirmRenewal(changeCtx, target, expected)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[%s] 已续期映射 - %s -> %s (%s), 过期时间: %s -> %s", target.Name,
+		renewed.GetGlobalAddress(), renewed.GetLocalAddress(), renewed.Protocol,
+		notification.FormatExpiry(oldExpiry), renewed.ExpiryDate.Format(time.DateTime))
+
+	if err := s.sendRenewalNotification(ctx, target, renewed, oldExpiry); err != nil {
+		log.Printf("[%s] 发送续期通知失败 - %s: %v", target.Name, renewed.GetGlobalAddress(), err)
+	}
+
+	_, err = s.saveIfChanged(ctx, target, 1)
+	return err
+}
+
+// expectedRenewal 返回续期到expiry后预期的条目，过期标记保持原来的格式
+func expectedRenewal(target *RouterTarget, entry *nat.NATEntry, expiry time.Time) (*nat.NATEntry, error) {
+	renewed := *entry
+	renewed.Description = nat.WithExpiryTag(entry.Description, expiry)
+	if err := renewed.ParseExpiryDateWithTime(target.Config.ExpiryTime.Hour, target.Config.ExpiryTime.Minute, target.Config.Location()); err != nil {
+		return nil, fmt.Errorf("解析续期后的过期时间失败: %v", err)
+	}
+	return &renewed, nil
+}
+
+// confirmRenewal 重新读取条目，确认路由器上的过期时间已更新为预期值；演练模式下返回预期的续期结果
+func (s *NATManagerService) confirmRenewal(ctx context.Context, target *RouterTarget, expected *nat.NATEntry) (*nat.NATEntry, error) {
+	if s.dryRun {
+		return expected, nil
+	}
+
+	renewed, err := s.findEntry(ctx, target, expected.GetGlobalAddress(), expected.Protocol)
+	if err != nil {
+		return nil, fmt.Errorf("续期后确认失败: %v", err)
+	}
+	if renewed.ExpiryDate == nil || !renewed.ExpiryDate.Equal(*expected.ExpiryDate) {
+		return nil, fmt.Errorf("续期后确认失败，当前描述: %s，期望过期时间: %s",
+			renewed.Description, expected.ExpiryDate.Format(time.DateTime))
+	}
+	return renewed, nil
+}
+
+// findEntry 在路由器上按外网地址端口和协议查找条目
+func (s *NATManagerService) findEntry(ctx context.Context, target *RouterTarget, globalAddress, protocol string) (*nat.NATEntry, error) {
+	entries, err := target.Repo.GetAllEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取NAT条目失败: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.GetGlobalAddress() == globalAddress && (protocol == "" || strings.EqualFold(entry.Protocol, protocol)) {
+			entry.Router = target.Name
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("[%s] 未找到映射: %s %s", target.Name, protocol, globalAddress)
+}
+
+// sendRenewalNotification 发送续期通知
+func (s *NATManagerService) sendRenewalNotification(ctx context.Context, target *RouterTarget, entry *nat.NATEntry, oldExpiry time.Time) error {
+	// 获取正确的中文描述
+	description := s.descMapper.GetDescription(entry.GetGlobalAddress(), entry.DescriptionText())
+
+	notify := &notification.RenewalNotification{
+		Source:        entry.Router,
+		GlobalAddress: entry.GetGlobalAddress(),
+		LocalAddress:  entry.GetLocalAddress(),
+		Protocol:      entry.Protocol,
+		Description:   description,
+		Owner:         entry.Owner,
+		Ticket:        entry.Ticket,
+		Group:         entry.Group,
+		OldExpiryDate: oldExpiry,
+		ExpiryDate:    *entry.ExpiryDate,
+		RenewTime:     s.routerNow(target),
+	}
+
+	return s.notify(ctx, func(ctx context.Context) error {
+		return s.notificationSvc.SendRenewalNotification(ctx, notify)
+	})
+}
+
+// findRouter 按名称查找路由器，只配置了一个路由器时名称可以为空
+func (s *NATManagerService) findRouter(name string) (*RouterTarget, error) {
+	if name == "" {
+		if len(s.routers) == 1 {
+			return s.routers[0], nil
+		}
+		return nil, fmt.Errorf("配置了多个路由器，请使用 --router 指定")
+	}
+
+	for _, target := range s.routers {
+		if target.Name == name {
+			return target, nil
+		}
+	}
+	return nil, fmt.Errorf("未找到路由器: %s", name)
+}
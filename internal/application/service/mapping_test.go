@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// mappingLine 返回模拟器NAT表中外网端口对应的配置行
+func (e *testEnv) mappingLine(globalPort string) string {
+	for _, m := range e.sim.Mappings() {
+		if strings.Contains(m.Line, "global 117.149.14.2 "+globalPort+" ") {
+			return m.Line
+		}
+	}
+	return ""
+}
+
+// renewDate 返回days天后的日期，与 --expire 的解析结果一致为当天0点
+func renewDate(days int) time.Time {
+	date := time.Now().AddDate(0, 0, days)
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func TestRenewMappingE2E(t *testing.T) {
+	env := newTestEnv(t)
+	date := renewDate(60)
+
+	if err := env.svc.RenewMapping(context.Background(), "", "117.149.14.2:54188", "tcp", date); err != nil {
+		t.Fatalf("RenewMapping() = %v", err)
+	}
+
+	want := "nat server protocol tcp global 117.149.14.2 54188 inside 192.168.1.109 22 description soon-ssh vp=" + date.Format("060102")
+	if got := env.mappingLine("54188"); got != want {
+		t.Errorf("续期后的配置行 = %q, 期望 %q", got, want)
+	}
+	if len(env.notifier.renewal) != 1 {
+		t.Fatalf("续期通知 %d 条, 期望 1 条", len(env.notifier.renewal))
+	}
+	if got := env.notifier.renewal[0].ExpiryDate.Format("2006-01-02 15:04"); got != date.Format("2006-01-02")+" 21:30" {
+		t.Errorf("续期通知中的过期时间 = %s, 期望 %s 21:30", got, date.Format("2006-01-02"))
+	}
+	if got := env.sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 期望 1", got)
+	}
+}
+
+func TestRenewMappingKeepsTagFormatE2E(t *testing.T) {
+	env := newTestEnv(t)
+	tag := "vp=" + time.Now().AddDate(0, 0, 5).Format("060102") + "1800"
+	if err := env.sim.AddMapping("GigabitEthernet0/0", "nat server protocol tcp global 117.149.14.2 9000 inside 192.168.1.120 9000 description ops "+tag); err != nil {
+		t.Fatal(err)
+	}
+	date := renewDate(30)
+
+	if err := env.svc.RenewMapping(context.Background(), "", "117.149.14.2:9000", "tcp", date); err != nil {
+		t.Fatalf("RenewMapping() = %v", err)
+	}
+
+	// 原标记带时分，续期只替换日期
+	want := "nat server protocol tcp global 117.149.14.2 9000 inside 192.168.1.120 9000 description ops vp=" + date.Format("060102") + "1800"
+	if got := env.mappingLine("9000"); got != want {
+		t.Errorf("续期后的配置行 = %q, 期望 %q", got, want)
+	}
+	if len(env.notifier.renewal) != 1 || env.notifier.renewal[0].ExpiryDate.Format("15:04") != "18:00" {
+		t.Errorf("续期通知 = %+v, 期望过期时间为 18:00", env.notifier.renewal)
+	}
+}
+
+func TestRenewMappingRejectsPastDateE2E(t *testing.T) {
+	env := newTestEnv(t)
+	before := env.mappingLine("54188")
+
+	if err := env.svc.RenewMapping(context.Background(), "", "117.149.14.2:54188", "tcp", renewDate(-1)); err == nil {
+		t.Fatal("续期到已过去的日期时 RenewMapping() 应返回错误")
+	}
+
+	if env.hasCommand("system-view") {
+		t.Errorf("续期日期无效时不应发送配置命令: %v", env.sim.Commands())
+	}
+	if got := env.mappingLine("54188"); got != before {
+		t.Errorf("配置行被修改: %q -> %q", before, got)
+	}
+	if len(env.notifier.renewal) != 0 {
+		t.Errorf("不应发送续期通知: %+v", env.notifier.renewal)
+	}
+}
+
+func TestRenewMappingWithoutExpiryTagE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	// 8443 的描述既没有 vp= 也没有 ttl=，错误信息应说明两种标记
+	err := env.svc.RenewMapping(context.Background(), "", "117.149.14.2:8443", "tcp", renewDate(30))
+	if err == nil || !strings.Contains(err.Error(), "vp=") || !strings.Contains(err.Error(), "ttl=") {
+		t.Fatalf("RenewMapping() = %v, 期望说明没有 vp= 或 ttl= 标记", err)
+	}
+	if env.hasCommand("system-view") {
+		t.Errorf("没有过期标记时不应发送配置命令: %v", env.sim.Commands())
+	}
+}
+
+func TestRenewMappingRollbackE2E(t *testing.T) {
+	env := newTestEnv(t)
+	before := env.mappingLine("54188")
+	date := renewDate(60)
+
+	// 删除原配置后写入新配置失败，应恢复原配置
+	renewed := "nat server protocol tcp global 117.149.14.2 54188 inside 192.168.1.109 22 description soon-ssh vp=" + date.Format("060102")
+	env.sim.FailCommand(renewed, " % The global address and port have been used by another internal server.")
+
+	if err := env.svc.RenewMapping(context.Background(), "", "117.149.14.2:54188", "tcp", date); err == nil {
+		t.Fatal("写入新配置失败时 RenewMapping() 应返回错误")
+	}
+
+	if got := env.mappingLine("54188"); got != before {
+		t.Errorf("回滚后的配置行 = %q, 期望恢复为 %q", got, before)
+	}
+	commands := env.sim.Commands()
+	if len(commands) == 0 || commands[len(commands)-1] != before {
+		t.Errorf("最后一条命令应为恢复原配置 %q, 实际命令: %v", before, commands)
+	}
+	if len(env.notifier.renewal) != 0 {
+		t.Errorf("续期失败时不应发送续期通知: %+v", env.notifier.renewal)
+	}
+	if got := env.sim.SaveCount(); got != 0 {
+		t.Errorf("续期失败时不应保存，保存次数 = %d", got)
+	}
+}
+
+// newMapping 返回在 GigabitEthernet0/0 上新建TCP映射的参数，与 --mode=create 的命令行参数对应
+func newMapping(globalPort, localPort int, description string) *nat.NATEntry {
+	return &nat.NATEntry{
+		Interface:   "GigabitEthernet0/0",
+		Protocol:    "TCP",
+		GlobalIP:    "117.149.14.2",
+		GlobalPort:  globalPort,
+		LocalIP:     "192.168.1.130",
+		LocalPort:   localPort,
+		Description: description,
+	}
+}
+
+// configCommands 返回模拟器收到的修改配置的命令
+func (e *testEnv) configCommands() []string {
+	var cmds []string
+	for _, cmd := range e.sim.Commands() {
+		if strings.HasPrefix(cmd, "nat server") || strings.HasPrefix(cmd, "undo nat server") {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+func TestCreateMappingE2E(t *testing.T) {
+	env := newTestEnv(t)
+	date := renewDate(30)
+
+	if err := env.svc.CreateMapping(context.Background(), "", newMapping(9000, 80, "web own=zhangsan"), date); err != nil {
+		t.Fatalf("CreateMapping() = %v", err)
+	}
+
+	// 过期标记由工具追加到描述末尾
+	want := "nat server protocol tcp global 117.149.14.2 9000 inside 192.168.1.130 80 description web own=zhangsan vp=" + date.Format("060102")
+	if got := env.mappingLine("9000"); got != want {
+		t.Errorf("创建的配置行 = %q, 期望 %q", got, want)
+	}
+	if got := env.configCommands(); len(got) != 1 {
+		t.Errorf("配置命令 = %v, 期望只发送一条 nat server 命令", got)
+	}
+	if got := env.sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 期望 1", got)
+	}
+}
+
+func TestCreateMappingDefaultExpiryE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	// 描述映射文件未配置 default_expiry_days 时有效期为 defaultExpiryDays 天
+	if err := env.svc.CreateMapping(context.Background(), "", newMapping(9000, 80, "web"), time.Time{}); err != nil {
+		t.Fatalf("CreateMapping() = %v", err)
+	}
+	want := "description web vp=" + time.Now().AddDate(0, 0, defaultExpiryDays).Format("060102")
+	if got := env.mappingLine("9000"); !strings.HasSuffix(got, want) {
+		t.Errorf("创建的配置行 = %q, 期望以 %q 结尾", got, want)
+	}
+
+	// 配置了 default_expiry_days 时使用配置的天数
+	descFile := filepath.Join(t.TempDir(), "descriptions.yaml")
+	if err := os.WriteFile(descFile, []byte("default_expiry_days: 30\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.svc.descMapper.LoadMappings(descFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.svc.CreateMapping(context.Background(), "", newMapping(9001, 81, "api"), time.Time{}); err != nil {
+		t.Fatalf("CreateMapping() = %v", err)
+	}
+	want = "description api vp=" + time.Now().AddDate(0, 0, 30).Format("060102")
+	if got := env.mappingLine("9001"); !strings.HasSuffix(got, want) {
+		t.Errorf("创建的配置行 = %q, 期望以 %q 结尾", got, want)
+	}
+}
+
+func TestCreateMappingTTLE2E(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := env.svc.CreateMapping(context.Background(), "", newMapping(9000, 80, "ci ttl=30d"), time.Time{}); err != nil {
+		t.Fatalf("CreateMapping() = %v", err)
+	}
+
+	// 使用 ttl= 时记录创建日期，不再追加 vp=
+	want := "description ci ttl=30d ct=" + time.Now().Format("060102")
+	if got := env.mappingLine("9000"); !strings.HasSuffix(got, want) {
+		t.Errorf("创建的配置行 = %q, 期望以 %q 结尾", got, want)
+	}
+}
+
+func TestCreateMappingRejectsInvalidE2E(t *testing.T) {
+	mismatched := newMapping(9000, 100, "range")
+	mismatched.GlobalPortEnd = 9010
+	mismatched.LocalPortEnd = 105
+	badIP := newMapping(9000, 80, "web")
+	badIP.LocalIP = "192.168.1.300"
+
+	tests := []struct {
+		name   string
+		entry  *nat.NATEntry
+		expiry time.Time
+	}{
+		{"已过去的过期日期", newMapping(9000, 80, "web"), renewDate(-1)},
+		{"无效的内网IP", badIP, renewDate(30)},
+		{"内外网端口范围大小不一致", mismatched, renewDate(30)},
+		{"描述包含问号", newMapping(9000, 80, "web?"), renewDate(30)},
+	}
+
+	for _, tt := range tests {
+		env := newTestEnv(t)
+		if err := env.svc.CreateMapping(context.Background(), "", tt.entry, tt.expiry); err == nil {
+			t.Errorf("%s: CreateMapping() 应返回错误", tt.name)
+		}
+		if env.hasCommand("system-view") || env.sim.SaveCount() != 0 {
+			t.Errorf("%s: 参数无效时不应修改配置, 命令: %v", tt.name, env.sim.Commands())
+		}
+	}
+}
+
+func TestCreateMappingConflictE2E(t *testing.T) {
+	env := newTestEnv(t)
+	for _, line := range []string{
+		"nat server protocol tcp global 117.149.14.2 10000 10010 inside 192.168.1.140 10000 10010 description range vp=991231",
+		"nat server protocol tcp global current-interface 2222 inside 192.168.1.141 22 description iface vp=991231",
+	} {
+		if err := env.sim.AddMapping("GigabitEthernet0/0", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	overlapping := newMapping(9995, 9995, "overlap")
+	overlapping.GlobalPortEnd = 10000
+	overlapping.LocalPortEnd = 10000
+	sameInterface := newMapping(2222, 22, "iface")
+	sameInterface.GlobalIP = ""
+	sameInterface.GlobalInterface = "current-interface"
+
+	tests := []struct {
+		name  string
+		entry *nat.NATEntry
+	}{
+		{"相同端口", newMapping(54188, 22, "ssh")},
+		{"端口在已有范围内", newMapping(10005, 80, "in-range")},
+		{"端口范围重叠", overlapping},
+		{"同一接口的 current-interface", sameInterface},
+	}
+
+	for _, tt := range tests {
+		if err := env.svc.CreateMapping(context.Background(), "", tt.entry, renewDate(30)); err == nil {
+			t.Errorf("%s: 外网端口冲突时 CreateMapping() 应返回错误", tt.name)
+		}
+	}
+	if got := env.configCommands(); len(got) != 0 || env.sim.SaveCount() != 0 {
+		t.Errorf("外网端口冲突时不应发送配置命令: %v", got)
+	}
+
+	// 不同接口的 current-interface 不冲突
+	otherInterface := *sameInterface
+	otherInterface.Interface = "GigabitEthernet0/1"
+	if err := env.svc.CreateMapping(context.Background(), "", &otherInterface, renewDate(30)); err != nil {
+		t.Errorf("不同接口的 current-interface: CreateMapping() = %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"time"
 
@@ -19,105 +22,247 @@ const (
 	OperationSmart   = "smart"
 )
 
+// RouterTarget 需要处理的路由器
+type RouterTarget struct {
+	Name   string               // 路由器名称，用于日志和通知的消息来源
+	Repo   nat.Repository       // 该路由器的NAT仓储
+	Config *config.RouterConfig // 该路由器的过期及提醒配置
+	Clock  nat.Clock            // 该路由器判断过期使用的时钟，为空时使用服务的时钟
+}
+
 // NATManagerService NAT管理应用服务
 type NATManagerService struct {
-	natRepo         nat.Repository
+	routers         []*RouterTarget
 	notificationSvc notification.Service
 	descMapper      *description.Mapper
+	archive         nat.Archive
 	config          *config.Config
+	runtime         config.RuntimeConfig // 补全默认值后的运行时配置
+	notifySlots     chan struct{}        // 限制同时发送的通知数，所有路由器共用
+	clock           nat.Clock            // 判断过期使用的时钟
+	dryRun          bool                 // 演练模式，不写备份归档，也不复查删除结果
 }
 
 // NewNATManagerService 创建NAT管理服务
 func NewNATManagerService(
-	natRepo nat.Repository,
+	routers []*RouterTarget,
 	notificationSvc notification.Service,
 	descMapper *description.Mapper,
+	archive nat.Archive,
 	cfg *config.Config,
+	dryRun bool,
 ) *NATManagerService {
+	runtime := cfg.Runtime
+	runtime.ApplyDefaults()
+
 	return &NATManagerService{
-		natRepo:         natRepo,
+		routers:         routers,
 		notificationSvc: notificationSvc,
 		descMapper:      descMapper,
+		archive:         archive,
 		config:          cfg,
+		runtime:         runtime,
+		notifySlots:     make(chan struct{}, runtime.NotifyConcurrency),
+		clock:           nat.SystemClock{},
+		dryRun:          dryRun,
+	}
+}
+
+// SetClock 设置判断过期使用的时钟，未单独设置时钟的路由器都使用它
+func (s *NATManagerService) SetClock(clock nat.Clock) {
+	s.clock = clock
+}
+
+// routerNow 返回路由器所在时区的当前时间，用于判断过期和通知中显示的时间
+func (s *NATManagerService) routerNow(target *RouterTarget) time.Time {
+	clock := s.clock
+	if target.Clock != nil {
+		clock = target.Clock
 	}
+	return clock.Now().In(target.Config.Location())
 }
 
 // CheckAndNotify 检查并发送过期通知
-func (s *NATManagerService) CheckAndNotify() error {
-	return s.processEntries(OperationNotify)
+func (s *NATManagerService) CheckAndNotify(ctx context.Context) error {
+	return s.processEntries(ctx, OperationNotify)
 }
 
 // CleanupExpired 清理已过期的条目
-func (s *NATManagerService) CleanupExpired() error {
-	return s.processEntries(OperationCleanup)
+func (s *NATManagerService) CleanupExpired(ctx context.Context) error {
+	return s.processEntries(ctx, OperationCleanup)
 }
 
 // SmartProcess 智能处理模式：自动决定通知或删除
-func (s *NATManagerService) SmartProcess() error {
-	return s.processEntries(OperationSmart)
+func (s *NATManagerService) SmartProcess(ctx context.Context) error {
+	return s.processEntries(ctx, OperationSmart)
 }
 
-// processEntries 统一的条目处理方法
-func (s *NATManagerService) processEntries(operation string) error {
-	log.Printf("开始执行%s操作", s.getOperationName(operation))
+// changeContext 返回修改路由器配置使用的上下文。ctx已取消时返回错误，不再开始新的修改；
+// 已开始的修改不随ctx取消而中断，避免停在删除旧配置之后、写入新配置之前
+func changeContext(ctx context.Context) (context.Context, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("运行已取消，未执行修改: %w", err)
+	}
+	return context.WithoutCancel(ctx), nil
+}
+
+// processEntries 统一的条目处理方法，依次处理所有路由器，ctx取消后不再处理剩余的路由器
+func (s *NATManagerService) processEntries(ctx context.Context, operation string) error {
+	runID := s.newRunID()
+	log.Printf("开始执行%s操作，运行ID: %s，路由器数量: %d", s.getOperationName(operation), runID, len(s.routers))
+	if s.dryRun {
+		log.Println("演练模式：只打印将要执行的命令和通知，不修改路由器，不发送通知")
+	}
 
-	entries, err := s.natRepo.GetAllEntries()
+	failed := 0
+	var remaining []*nat.NATEntry
+	for i, target := range s.routers {
+		if ctx.Err() != nil {
+			log.Printf("运行已取消，跳过剩余 %d 个路由器", len(s.routers)-i)
+			break
+		}
+
+		results, err := s.processRouter(ctx, target, operation, runID)
+		if err != nil {
+			log.Printf("[%s] %v", target.Name, err)
+			failed++
+			continue
+		}
+		failed += len(results.Errors)
+		if results.SaveError != nil {
+			failed++
+		}
+		remaining = append(remaining, results.Remaining...)
+	}
+
+	// 删除后复查仍然存在的条目需要人工处理
+	if len(remaining) > 0 {
+		log.Printf("以下 %d 个条目删除后仍存在于路由器上:", len(remaining))
+		for _, entry := range remaining {
+			log.Printf("  [%s] %s -> %s (%s), 接口: %s", entry.Router,
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, entry.Interface)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s已取消，已开始的修改均已完成，失败操作 %d 个: %w", s.getOperationName(operation), failed, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s存在 %d 个失败操作", s.getOperationName(operation), failed)
+	}
+	return nil
+}
+
+// processRouter 处理单个路由器上的条目
+func (s *NATManagerService) processRouter(ctx context.Context, target *RouterTarget, operation, runID string) (*ProcessResult, error) {
+	entries, err := target.Repo.GetAllEntries(ctx)
 	if err != nil {
-		return fmt.Errorf("获取NAT条目失败: %v", err)
+		return nil, fmt.Errorf("获取NAT条目失败: %v", err)
+	}
+	for _, entry := range entries {
+		entry.Router = target.Name
 	}
 
-	reminderDays := s.config.Router.ReminderBeforeExpiration
-	log.Printf("获取NAT条目成功，总条目数: %d，提前 %d 天 提醒", len(entries), reminderDays)
+	reminderDays := target.Config.ReminderBeforeExpiration
+	now := s.routerNow(target)
+	log.Printf("[%s] 获取NAT条目成功，总条目数: %d，提前 %d 天 提醒", target.Name, len(entries), reminderDays)
 
 	// 添加调试信息：显示有过期信息的条目
 	expiredCount := 0
 	willExpireCount := 0
 	noExpiryCount := 0
-	
+	invalidCount := 0
+
 	for _, entry := range entries {
 		if !entry.HasExpiryInfo() {
 			noExpiryCount++
 			continue
 		}
-		
-		if entry.IsExpired() {
+
+		if entry.HasInvalidExpiry() {
+			invalidCount++
+			log.Printf("[%s] 发现过期标记无效的条目: %s -> %s, %s%s", target.Name,
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.InvalidExpiry, entryTags(entry))
+			continue
+		}
+
+		if entry.IsExpired(now) {
 			expiredCount++
-			log.Printf("发现已过期条目: %s -> %s, 过期时间: %s", 
-				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.ExpiryDate.Format(time.DateTime))
-		} else if entry.WillExpireIn(reminderDays) {
+			log.Printf("[%s] 发现已过期条目: %s -> %s, 过期时间: %s%s", target.Name,
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.ExpiryDate.Format(time.DateTime), entryTags(entry))
+		} else if entry.WillExpireIn(now, reminderDays) {
 			willExpireCount++
-			log.Printf("发现即将过期条目: %s -> %s, 过期时间: %s", 
-				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.ExpiryDate.Format(time.DateTime))
+			log.Printf("[%s] 发现即将过期条目: %s -> %s, 过期时间: %s%s", target.Name,
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.ExpiryDate.Format(time.DateTime), entryTags(entry))
 		}
 	}
-	
-	log.Printf("条目统计 - 无过期信息: %d, 即将过期: %d, 已过期: %d", 
-		noExpiryCount, willExpireCount, expiredCount)
+
+	log.Printf("[%s] 条目统计 - 无过期信息: %d, 标记无效: %d, 即将过期: %d, 已过期: %d", target.Name,
+		noExpiryCount, invalidCount, willExpireCount, expiredCount)
 
 	// 使用并发处理提高效率
-	results := s.processEntriesConcurrently(entries, operation, reminderDays)
-	
-	log.Printf("%s完成，发送通知数量: %d，删除条目数量: %d", 
-		s.getOperationName(operation), results.NotifyCount, results.CleanupCount)
-	
-	return nil
+	results := s.processEntriesConcurrently(ctx, target, entries, operation, now, reminderDays, runID)
+
+	// 重新读取条目确认删除结果，只为确认已删除的条目发送通知
+	s.verifyDeletions(ctx, target, results)
+
+	// 所有删除完成后统一保存一次
+	results.Saved, results.SaveError = s.saveIfChanged(ctx, target, len(results.Deleted))
+
+	log.Printf("[%s] %s完成，发送通知数量: %d，删除条目数量: %d，失败数量: %d", target.Name,
+		s.getOperationName(operation), results.NotifyCount, results.CleanupCount, len(results.Errors))
+	if results.InvalidTagCount > 0 {
+		log.Printf("[%s] 已发送标记无效提醒数量: %d", target.Name, results.InvalidTagCount)
+	}
+	if results.Protected > 0 {
+		log.Printf("[%s] %d 个已过期条目带 keep 标记，未删除", target.Name, results.Protected)
+	}
+	if results.Skipped > 0 {
+		log.Printf("[%s] 运行已取消，%d 个条目未处理", target.Name, results.Skipped)
+	}
+
+	return results, nil
+}
+
+// saveIfChanged 本次运行有修改且配置了 save_after_changes 时保存路由器配置。
+// 运行取消时也会保存，已完成的修改不会因重启丢失
+func (s *NATManagerService) saveIfChanged(ctx context.Context, target *RouterTarget, changes int) (bool, error) {
+	if changes == 0 || !target.Config.SaveAfterChanges {
+		return false, nil
+	}
+
+	if err := target.Repo.SaveConfig(context.WithoutCancel(ctx)); err != nil {
+		log.Printf("[%s] 保存配置失败，%d 项修改在重启后会丢失: %v", target.Name, changes, err)
+		return false, fmt.Errorf("保存配置失败: %w", err)
+	}
+
+	log.Printf("[%s] 已保存配置，本次修改 %d 项", target.Name, changes)
+	return true, nil
 }
 
 // ProcessResult 处理结果
 type ProcessResult struct {
-	NotifyCount  int
-	CleanupCount int
-	Errors       []error
+	NotifyCount     int
+	InvalidTagCount int // 已发送的标记无效提醒数
+	CleanupCount    int // 复查确认已删除的条目数
+	Errors          []error
+	Deleted         []*nat.NATEntry // 已执行删除命令的条目
+	Remaining       []*nat.NATEntry // 删除后复查仍存在的条目
+	Skipped         int             // 运行取消后未处理的条目数
+	Protected       int             // 带 keep 标记而未删除的过期条目数
+	Saved           bool            // 是否已保存配置
+	SaveError       error           // 保存配置失败的原因
 }
 
-// processEntriesConcurrently 并发处理条目
-func (s *NATManagerService) processEntriesConcurrently(entries []*nat.NATEntry, operation string, reminderDays int) *ProcessResult {
+// processEntriesConcurrently 并发处理条目，同时处理的条目数由 runtime.workers 限制，
+// 其中同时进行的删除数再由 runtime.router_concurrency 限制
+func (s *NATManagerService) processEntriesConcurrently(ctx context.Context, target *RouterTarget, entries []*nat.NATEntry, operation string, now time.Time, reminderDays int, runID string) *ProcessResult {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	result := &ProcessResult{}
 
-	// 限制并发数量，避免过多连接
-	semaphore := make(chan struct{}, 5)
+	semaphore := make(chan struct{}, s.runtime.Workers)
+	changes := make(chan struct{}, s.runtime.RouterConcurrency)
 
 	for _, entry := range entries {
 		if !entry.HasExpiryInfo() {
@@ -127,13 +272,38 @@ func (s *NATManagerService) processEntriesConcurrently(entries []*nat.NATEntry,
 		wg.Add(1)
 		go func(e *nat.NATEntry) {
 			defer wg.Done()
-			semaphore <- struct{}{} // 获取信号量
+			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
+			// 运行取消后不再开始新的通知或删除
+			if ctx.Err() != nil {
+				mu.Lock()
+				result.Skipped++
+				mu.Unlock()
+				return
+			}
+
+			// 标记无效的条目不会过期，发送提醒的模式下提醒所属群组修正标记
+			if e.HasInvalidExpiry() {
+				if operation == OperationCleanup {
+					return
+				}
+				if err := s.sendInvalidTagNotification(ctx, target, e); err != nil {
+					mu.Lock()
+					result.Errors = append(result.Errors, fmt.Errorf("发送标记无效提醒失败 - %s: %v", e.GetGlobalAddress(), err))
+					mu.Unlock()
+					return
+				}
+				mu.Lock()
+				result.InvalidTagCount++
+				mu.Unlock()
+				return
+			}
+
 			switch operation {
 			case OperationNotify:
-				if e.WillExpireIn(reminderDays) {
-					if err := s.sendExpiryNotification(e); err != nil {
+				if e.WillExpireIn(now, reminderDays) {
+					if err := s.sendExpiryNotification(ctx, target, e); err != nil {
 						mu.Lock()
 						result.Errors = append(result.Errors, fmt.Errorf("发送通知失败 - %s: %v", e.GetGlobalAddress(), err))
 						mu.Unlock()
@@ -142,36 +312,40 @@ func (s *NATManagerService) processEntriesConcurrently(entries []*nat.NATEntry,
 					mu.Lock()
 					result.NotifyCount++
 					mu.Unlock()
-					log.Printf("已发送过期提醒 - %s -> %s, 过期时间: %s", 
+					log.Printf("[%s] 已发送过期提醒 - %s -> %s, 过期时间: %s", target.Name,
 						e.GetGlobalAddress(), e.GetLocalAddress(), e.ExpiryDate.Format(time.DateTime))
 				}
 
 			case OperationCleanup:
-				if e.IsExpired() {
-					if err := s.deleteAndNotify(e); err != nil {
+				if e.IsExpired(now) && e.Keep {
+					s.skipProtected(target, e, result, &mu)
+				} else if e.IsExpired(now) {
+					if err := s.deleteEntry(ctx, target, e, runID, changes); err != nil {
 						mu.Lock()
 						result.Errors = append(result.Errors, err)
 						mu.Unlock()
 						return
 					}
 					mu.Lock()
-					result.CleanupCount++
+					result.Deleted = append(result.Deleted, e)
 					mu.Unlock()
 				}
 
 			case OperationSmart:
-				if e.IsExpired() {
-					if err := s.deleteAndNotify(e); err != nil {
+				if e.IsExpired(now) && e.Keep {
+					s.skipProtected(target, e, result, &mu)
+				} else if e.IsExpired(now) {
+					if err := s.deleteEntry(ctx, target, e, runID, changes); err != nil {
 						mu.Lock()
 						result.Errors = append(result.Errors, err)
 						mu.Unlock()
 						return
 					}
 					mu.Lock()
-					result.CleanupCount++
+					result.Deleted = append(result.Deleted, e)
 					mu.Unlock()
-				} else if e.WillExpireIn(reminderDays) {
-					if err := s.sendExpiryNotification(e); err != nil {
+				} else if e.WillExpireIn(now, reminderDays) {
+					if err := s.sendExpiryNotification(ctx, target, e); err != nil {
 						mu.Lock()
 						result.Errors = append(result.Errors, fmt.Errorf("发送通知失败 - %s: %v", e.GetGlobalAddress(), err))
 						mu.Unlock()
@@ -180,7 +354,7 @@ func (s *NATManagerService) processEntriesConcurrently(entries []*nat.NATEntry,
 					mu.Lock()
 					result.NotifyCount++
 					mu.Unlock()
-					log.Printf("已发送过期提醒 - %s -> %s, 过期时间: %s",
+					log.Printf("[%s] 已发送过期提醒 - %s -> %s, 过期时间: %s", target.Name,
 						e.GetGlobalAddress(), e.GetLocalAddress(), e.ExpiryDate.Format(time.DateTime))
 				}
 			}
@@ -191,33 +365,156 @@ func (s *NATManagerService) processEntriesConcurrently(entries []*nat.NATEntry,
 
 	// 记录错误
 	for _, err := range result.Errors {
-		log.Printf("处理错误: %v", err)
+		log.Printf("[%s] 处理错误: %v", target.Name, err)
 	}
 
 	return result
 }
 
-// deleteAndNotify 删除条目并发送通知
-func (s *NATManagerService) deleteAndNotify(entry *nat.NATEntry) error {
-	// 删除条目
-	if err := s.natRepo.DeleteEntry(entry); err != nil {
-		return fmt.Errorf("删除过期条目失败 - %s -> %s (%s), 过期时间: %s, 错误: %v",
-			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, 
-			entry.ExpiryDate.Format(time.DateTime), err)
+// skipProtected 记录带 keep 标记而不删除的过期条目
+func (s *NATManagerService) skipProtected(target *RouterTarget, entry *nat.NATEntry, result *ProcessResult, mu *sync.Mutex) {
+	log.Printf("[%s] 条目带 keep 标记，跳过删除 - %s -> %s (%s)%s", target.Name,
+		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, entryTags(entry))
+	mu.Lock()
+	result.Protected++
+	mu.Unlock()
+}
+
+// entryTags 格式化条目的负责人和工单号，用于日志，没有时为空
+func entryTags(entry *nat.NATEntry) string {
+	var tags string
+	if entry.Owner != "" {
+		tags += ", 负责人: " + entry.Owner
+	}
+	if entry.Ticket != "" {
+		tags += ", 工单号: " + entry.Ticket
+	}
+	return tags
+}
+
+// deleteEntry 备份并删除条目，删除通知在复查确认后发送。changes 限制同一路由器上同时进行的删除数
+func (s *NATManagerService) deleteEntry(ctx context.Context, target *RouterTarget, entry *nat.NATEntry, runID string, changes chan struct{}) error {
+	select {
+	case changes <- struct{}{}:
+		defer func() { <-changes }()
+	case <-ctx.Done():
+		return fmt.Errorf("运行已取消，未执行删除 - %s -> %s (%s): %w",
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, ctx.Err())
 	}
 
-	// 删除成功后发送删除通知
-	if err := s.sendDeletionNotification(entry); err != nil {
-		log.Printf("发送删除通知失败 - %s: %v", entry.GetGlobalAddress(), err)
+	// 备份失败时不删除，保证每个被删除的条目都能恢复
+	if err := s.backupEntry(ctx, target, entry, runID); err != nil {
+		return fmt.Errorf("备份条目失败，跳过删除 - %s -> %s (%s): %w",
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, err)
 	}
 
-	log.Printf("已删除过期条目 - %s -> %s (%s), 过期时间: %s",
-		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, 
+	changeCtx, err := changeContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%v - %s -> %s (%s)", err, entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+	}
+	if err := target.Repo.DeleteEntry(changeCtx, entry); err != nil {
+		if errors.Is(err, nat.ErrEntryNotFound) {
+			return fmt.Errorf("删除过期条目失败，路由器上已不存在该条目 - %s -> %s (%s): %w",
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, err)
+		}
+		return fmt.Errorf("删除过期条目失败 - %s -> %s (%s), 过期时间: %s, 错误: %w",
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol,
+			entry.ExpiryDate.Format(time.DateTime), err)
+	}
+
+	log.Printf("[%s] 已执行删除 - %s -> %s (%s), 过期时间: %s", entry.Router,
+		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol,
 		entry.ExpiryDate.Format(time.DateTime))
-	
+
 	return nil
 }
 
+// verifyDeletions 删除完成后重新读取路由器条目，确认每个删除是否生效。
+// 确认已删除的条目发送删除通知，仍存在的条目记入 Remaining；无法重新读取时不发送任何删除通知。
+// 复查和删除通知属于删除的收尾，运行取消时仍会执行，否则已删除的映射之后不会再有通知；
+// 每条通知仍受 notify_timeout 限制
+func (s *NATManagerService) verifyDeletions(ctx context.Context, target *RouterTarget, result *ProcessResult) {
+	if len(result.Deleted) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	// 演练模式没有真正删除，按删除成功展示将要发送的通知
+	if s.dryRun {
+		for _, entry := range result.Deleted {
+			result.CleanupCount++
+			if err := s.sendDeletionNotification(ctx, target, entry); err != nil {
+				log.Printf("[%s] 发送删除通知失败 - %s: %v", target.Name, entry.GetGlobalAddress(), err)
+			}
+		}
+		return
+	}
+
+	current, err := target.Repo.GetAllEntries(ctx)
+	if err != nil {
+		log.Printf("[%s] 删除后重新读取NAT条目失败，%d 个删除未能确认: %v", target.Name, len(result.Deleted), err)
+		result.Errors = append(result.Errors, fmt.Errorf("删除后复查失败，%d 个删除未能确认: %v", len(result.Deleted), err))
+		return
+	}
+
+	for _, entry := range result.Deleted {
+		if containsMapping(current, entry) {
+			log.Printf("[%s] 删除未生效，条目仍存在 - %s -> %s (%s)", target.Name,
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+			result.Remaining = append(result.Remaining, entry)
+			result.Errors = append(result.Errors, fmt.Errorf("删除后条目仍存在 - %s -> %s (%s)",
+				entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol))
+			continue
+		}
+
+		result.CleanupCount++
+		log.Printf("[%s] 已确认删除过期条目 - %s -> %s (%s)", target.Name,
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+
+		if err := s.sendDeletionNotification(ctx, target, entry); err != nil {
+			log.Printf("[%s] 发送删除通知失败 - %s: %v", target.Name, entry.GetGlobalAddress(), err)
+		}
+	}
+}
+
+// containsMapping 判断条目列表中是否存在同一条映射
+func containsMapping(entries []*nat.NATEntry, target *nat.NATEntry) bool {
+	for _, entry := range entries {
+		if entry.SameMapping(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// backupEntry 将条目的原始配置行写入备份归档，备份时间与删除通知一样使用路由器的时钟和时区
+func (s *NATManagerService) backupEntry(ctx context.Context, target *RouterTarget, entry *nat.NATEntry, runID string) error {
+	configLine, err := target.Repo.BackupEntry(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	if s.dryRun {
+		log.Printf("[%s] [dry-run] 将备份配置行（未写入归档）: %s", entry.Router, configLine)
+		return nil
+	}
+
+	return s.archive.Append(&nat.BackupRecord{
+		RunID:      runID,
+		Router:     entry.Router,
+		Time:       s.routerNow(target),
+		Interface:  entry.Interface,
+		ConfigLine: configLine,
+		Entry:      entry,
+	})
+}
+
+// newRunID 生成运行ID，用于按批次恢复删除的条目。
+// 带上进程号，同一秒开始的两次运行（如定时任务和手动运行）不会使用相同的ID
+func (s *NATManagerService) newRunID() string {
+	return fmt.Sprintf("%s-%d", s.clock.Now().Format("20060102-150405"), os.Getpid())
+}
+
 // getOperationName 获取操作名称
 func (s *NATManagerService) getOperationName(operation string) string {
 	switch operation {
@@ -233,35 +530,81 @@ func (s *NATManagerService) getOperationName(operation string) string {
 }
 
 // sendExpiryNotification 发送过期通知
-func (s *NATManagerService) sendExpiryNotification(entry *nat.NATEntry) error {
+func (s *NATManagerService) sendExpiryNotification(ctx context.Context, target *RouterTarget, entry *nat.NATEntry) error {
 	// 获取正确的中文描述
-	description := s.descMapper.GetDescription(entry.GetGlobalAddress())
+	description := s.descMapper.GetDescription(entry.GetGlobalAddress(), entry.DescriptionText())
 
 	notify := &notification.ExpiryNotification{
+		Source:        entry.Router,
 		GlobalAddress: entry.GetGlobalAddress(),
 		LocalAddress:  entry.GetLocalAddress(),
 		Protocol:      entry.Protocol,
 		Description:   description,
+		Owner:         entry.Owner,
+		Ticket:        entry.Ticket,
+		Group:         entry.Group,
 		ExpiryDate:    *entry.ExpiryDate,
-		NotifyTime:    time.Now(),
+		NotifyTime:    s.routerNow(target),
 	}
 
-	return s.notificationSvc.SendNotification(notify)
+	return s.notify(ctx, func(ctx context.Context) error {
+		return s.notificationSvc.SendNotification(ctx, notify)
+	})
 }
 
 // sendDeletionNotification 发送删除通知
-func (s *NATManagerService) sendDeletionNotification(entry *nat.NATEntry) error {
+func (s *NATManagerService) sendDeletionNotification(ctx context.Context, target *RouterTarget, entry *nat.NATEntry) error {
 	// 获取正确的中文描述
-	description := s.descMapper.GetDescription(entry.GetGlobalAddress())
+	description := s.descMapper.GetDescription(entry.GetGlobalAddress(), entry.DescriptionText())
 
 	notify := &notification.DeletionNotification{
+		Source:        entry.Router,
 		GlobalAddress: entry.GetGlobalAddress(),
 		LocalAddress:  entry.GetLocalAddress(),
 		Protocol:      entry.Protocol,
 		Description:   description,
+		Owner:         entry.Owner,
+		Ticket:        entry.Ticket,
+		Group:         entry.Group,
 		ExpiryDate:    *entry.ExpiryDate,
-		DeleteTime:    time.Now(),
+		DeleteTime:    s.routerNow(target),
+	}
+
+	return s.notify(ctx, func(ctx context.Context) error {
+		return s.notificationSvc.SendDeletionNotification(ctx, notify)
+	})
+}
+
+// notify 在通知并发数和 runtime.notify_timeout 的限制下发送一条通知
+func (s *NATManagerService) notify(ctx context.Context, send func(ctx context.Context) error) error {
+	select {
+	case s.notifySlots <- struct{}{}:
+		defer func() { <-s.notifySlots }()
+	case <-ctx.Done():
+		return fmt.Errorf("等待发送通知时运行已取消: %w", ctx.Err())
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, s.runtime.NotifyTimeout)
+	defer cancel()
+	return send(sendCtx)
+}
+
+// sendInvalidTagNotification 发送过期标记无效的提醒
+func (s *NATManagerService) sendInvalidTagNotification(ctx context.Context, target *RouterTarget, entry *nat.NATEntry) error {
+	notify := &notification.InvalidTagNotification{
+		Source:        entry.Router,
+		GlobalAddress: entry.GetGlobalAddress(),
+		LocalAddress:  entry.GetLocalAddress(),
+		Protocol:      entry.Protocol,
+		Description:   entry.Description,
+		Reason:        entry.InvalidExpiry,
+		Owner:         entry.Owner,
+		Ticket:        entry.Ticket,
+		Group:         entry.Group,
+		NotifyTime:    s.routerNow(target),
 	}
 
-	return s.notificationSvc.SendDeletionNotification(notify)
-}
\ No newline at end of file
+	return s.notify(ctx, func(ctx context.Context) error {
+		return s.notificationSvc.SendInvalidTagNotification(ctx, notify)
+	})
+}
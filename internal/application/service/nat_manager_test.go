@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/domain/notification"
+	"h3c-nat-manager/internal/infrastructure/archive"
+	"h3c-nat-manager/internal/infrastructure/config"
+	"h3c-nat-manager/internal/infrastructure/description"
+)
+
+// gauge 记录同时进行的操作数的最大值
+type gauge struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+// enter 开始一个操作，模拟耗时后结束
+func (g *gauge) enter(d time.Duration) {
+	g.mu.Lock()
+	g.current++
+	if g.current > g.max {
+		g.max = g.current
+	}
+	g.mu.Unlock()
+
+	time.Sleep(d)
+
+	g.mu.Lock()
+	g.current--
+	g.mu.Unlock()
+}
+
+func (g *gauge) peak() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.max
+}
+
+// slowRepo 内存中的NAT仓储，删除有固定耗时并记录并发数
+type slowRepo struct {
+	nat.Repository
+	mu      sync.Mutex
+	entries []*nat.NATEntry
+	deletes gauge
+}
+
+func (r *slowRepo) GetAllEntries(ctx context.Context) ([]*nat.NATEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*nat.NATEntry(nil), r.entries...), nil
+}
+
+func (r *slowRepo) BackupEntry(ctx context.Context, entry *nat.NATEntry) (string, error) {
+	return "nat server " + entry.GetGlobalAddress(), nil
+}
+
+func (r *slowRepo) DeleteEntry(ctx context.Context, entry *nat.NATEntry) error {
+	r.deletes.enter(20 * time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.entries {
+		if e.SameMapping(entry) {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return nil
+		}
+	}
+	return nat.ErrEntryNotFound
+}
+
+// slowNotifier 发送有固定耗时并记录并发数，超过发送超时的通知返回错误
+type slowNotifier struct {
+	recordingNotifier
+	sends gauge
+	delay time.Duration
+}
+
+func (n *slowNotifier) SendNotification(ctx context.Context, notify *notification.ExpiryNotification) error {
+	n.sends.enter(n.delay)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return n.recordingNotifier.SendNotification(ctx, notify)
+}
+
+func (n *slowNotifier) SendDeletionNotification(ctx context.Context, notify *notification.DeletionNotification) error {
+	n.sends.enter(n.delay)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return n.recordingNotifier.SendDeletionNotification(ctx, notify)
+}
+
+// newRuntimeTestService 创建处理 expired 个已过期和 expiring 个即将过期条目的服务
+func newRuntimeTestService(t *testing.T, runtime config.RuntimeConfig, notifier notification.Service, expired, expiring int) (*NATManagerService, *slowRepo) {
+	t.Helper()
+
+	repo := &slowRepo{}
+	for i := 0; i < expired+expiring; i++ {
+		expiry := time.Now().AddDate(0, 0, -1)
+		if i >= expired {
+			expiry = time.Now().AddDate(0, 0, 3)
+		}
+		repo.entries = append(repo.entries, &nat.NATEntry{
+			Interface:   "GigabitEthernet0/0",
+			Protocol:    "TCP",
+			GlobalIP:    "117.149.14.2",
+			GlobalPort:  10000 + i,
+			LocalIP:     "192.168.1.10",
+			LocalPort:   10000 + i,
+			Description: "svc vp=" + expiry.Format("060102"),
+			ExpiryDate:  &expiry,
+		})
+	}
+
+	routerConfig := &config.RouterConfig{Name: "mem", ReminderBeforeExpiration: 10}
+	svc := NewNATManagerService(
+		[]*RouterTarget{{Name: routerConfig.Name, Repo: repo, Config: routerConfig}},
+		notifier,
+		description.NewMapper(),
+		archive.NewFileArchive(filepath.Join(t.TempDir(), "nat_backup.jsonl")),
+		&config.Config{Routers: []config.RouterConfig{*routerConfig}, Runtime: runtime},
+		false,
+	)
+	return svc, repo
+}
+
+func TestSmartProcessConcurrencyLimits(t *testing.T) {
+	notifier := &slowNotifier{delay: 20 * time.Millisecond}
+	svc, repo := newRuntimeTestService(t, config.RuntimeConfig{
+		Workers:           8,
+		RouterConcurrency: 1,
+		NotifyConcurrency: 2,
+	}, notifier, 6, 6)
+
+	if err := svc.SmartProcess(context.Background()); err != nil {
+		t.Fatalf("SmartProcess() = %v", err)
+	}
+
+	if got := repo.deletes.peak(); got != 1 {
+		t.Errorf("同时删除数最大为 %d, 期望 1", got)
+	}
+	if got := notifier.sends.peak(); got < 1 || got > 2 {
+		t.Errorf("同时发送通知数最大为 %d, 期望不超过 2", got)
+	}
+	if len(repo.entries) != 6 || len(notifier.expiry) != 6 || len(notifier.deletion) != 6 {
+		t.Errorf("剩余条目 %d, 过期提醒 %d, 删除通知 %d, 期望均为 6",
+			len(repo.entries), len(notifier.expiry), len(notifier.deletion))
+	}
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	notifier := &slowNotifier{delay: 50 * time.Millisecond}
+	svc, _ := newRuntimeTestService(t, config.RuntimeConfig{NotifyTimeout: 10 * time.Millisecond}, notifier, 0, 2)
+
+	if err := svc.CheckAndNotify(context.Background()); err == nil {
+		t.Error("CheckAndNotify() = nil, 期望发送超时的错误")
+	}
+	if len(notifier.expiry) != 0 {
+		t.Errorf("超时的通知不应记为已发送: %d", len(notifier.expiry))
+	}
+}
+
+func TestCleanupExpiredSkipsKeep(t *testing.T) {
+	notifier := &slowNotifier{}
+	svc, repo := newRuntimeTestService(t, config.RuntimeConfig{}, notifier, 2, 0)
+	repo.entries[0].Description += " keep own=zhangsan"
+	repo.entries[0].Keep = true
+
+	if err := svc.CleanupExpired(context.Background()); err != nil {
+		t.Fatalf("CleanupExpired() = %v", err)
+	}
+	if len(repo.entries) != 1 || !repo.entries[0].Keep {
+		t.Errorf("剩余条目 = %+v, 期望只保留带 keep 标记的条目", repo.entries)
+	}
+	if got := repo.deletes.peak(); got != 1 || len(notifier.deletion) != 1 {
+		t.Errorf("删除并发 %d, 删除通知 %d, 期望只删除一个条目", got, len(notifier.deletion))
+	}
+}
+
+func TestNotifyTimeInRouterTimezone(t *testing.T) {
+	notifier := &slowNotifier{}
+	svc, _ := newRuntimeTestService(t, config.RuntimeConfig{}, notifier, 1, 1)
+	svc.routers[0].Config.Timezone = "Asia/Shanghai"
+
+	if err := svc.SmartProcess(context.Background()); err != nil {
+		t.Fatalf("SmartProcess() = %v", err)
+	}
+	if len(notifier.expiry) != 1 || len(notifier.deletion) != 1 {
+		t.Fatalf("过期提醒 %d, 删除通知 %d, 期望均为 1", len(notifier.expiry), len(notifier.deletion))
+	}
+	if got := notifier.expiry[0].NotifyTime.Location().String(); got != "Asia/Shanghai" {
+		t.Errorf("提醒时间的时区 = %s, 期望 Asia/Shanghai", got)
+	}
+	if got := notifier.deletion[0].DeleteTime.Location().String(); got != "Asia/Shanghai" {
+		t.Errorf("删除时间的时区 = %s, 期望 Asia/Shanghai", got)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// RestoreMappings 从备份归档恢复被删除的映射。
+// 指定globalAddress时恢复该外网地址端口最近一次删除的配置，指定runID时恢复该次运行删除的所有配置。
+// expiry不为零值时按续期的方式替换配置中的过期标记；为零值时原样恢复，已过期的记录会跳过，避免下次运行再次删除
+func (s *NATManagerService) RestoreMappings(ctx context.Context, routerName, globalAddress, runID string, expiry time.Time) error {
+	if globalAddress == "" && runID == "" {
+		return fmt.Errorf("恢复需要使用 --global 或 --run-id 指定要恢复的映射")
+	}
+	if routerName != "" {
+		if _, err := s.findRouter(routerName); err != nil {
+			return err
+		}
+	}
+
+	records, err := s.archive.Records()
+	if err != nil {
+		return fmt.Errorf("读取备份归档失败: %v", err)
+	}
+
+	selected := selectBackupRecords(records, routerName, globalAddress, runID)
+	if len(selected) == 0 {
+		return fmt.Errorf("备份归档中没有匹配的记录 (路由器: %q, 外网地址: %q, 运行ID: %q)", routerName, globalAddress, runID)
+	}
+
+	// 按路由器分组，每个路由器恢复完成后保存一次
+	byRouter := make(map[string][]*nat.BackupRecord)
+	var order []string
+	for _, record := range selected {
+		if _, ok := byRouter[record.Router]; !ok {
+			order = append(order, record.Router)
+		}
+		byRouter[record.Router] = append(byRouter[record.Router], record)
+	}
+
+	failed := 0
+	for _, name := range order {
+		target, err := s.findRouter(name)
+		if err != nil {
+			log.Printf("跳过路由器 %s 的 %d 条备份: %v", name, len(byRouter[name]), err)
+			failed += len(byRouter[name])
+			continue
+		}
+
+		restored, errs := s.restoreOnRouter(ctx, target, byRouter[name], expiry)
+		failed += len(errs)
+		for _, err := range errs {
+			log.Printf("[%s] 恢复失败: %v", target.Name, err)
+		}
+
+		if _, err := s.saveIfChanged(ctx, target, restored); err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("恢复存在 %d 个失败操作", failed)
+	}
+	return nil
+}
+
+// restoreOnRouter 在单个路由器上恢复备份记录，已存在冲突映射或恢复后已过期的记录会跳过，ctx取消后不再恢复剩余的记录
+func (s *NATManagerService) restoreOnRouter(ctx context.Context, target *RouterTarget, records []*nat.BackupRecord, expiry time.Time) (int, []error) {
+	existing, err := target.Repo.GetAllEntries(ctx)
+	if err != nil {
+		return 0, []error{fmt.Errorf("获取NAT条目失败: %v", err)}
+	}
+
+	restored := 0
+	var errs []error
+	for _, record := range records {
+		conflict := false
+		for _, other := range existing {
+			if record.Entry.ConflictsWith(other) {
+				errs = append(errs, fmt.Errorf("外网地址端口 %s 已被 %s 使用，跳过恢复: %s",
+					record.Entry.GetGlobalAddress(), other.GetLocalAddress(), record.ConfigLine))
+				conflict = true
+				break
+			}
+		}
+		if conflict {
+			continue
+		}
+
+		entry, configLine := restoredEntry(record, expiry)
+		if err := entry.ParseDescription(target.Config.ExpiryTime.Hour, target.Config.ExpiryTime.Minute, target.Config.Location()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: 解析过期时间失败: %v", configLine, err))
+			continue
+		}
+		if entry.ExpiryDate != nil && !entry.ExpiryDate.After(s.routerNow(target)) {
+			errs = append(errs, fmt.Errorf("恢复后的过期时间 %s 已过，下次运行会再次删除，请使用 --expire 指定新的过期日期: %s",
+				entry.ExpiryDate.Format(time.DateTime), configLine))
+			continue
+		}
+
+		changeCtx, err := changeContext(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := target.Repo.RestoreEntry(changeCtx, record.Interface, configLine); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", configLine, err))
+			continue
+		}
+
+		restored++
+		existing = append(existing, entry)
+		log.Printf("[%s] 已恢复映射 - %s -> %s (%s), 运行ID: %s, 配置: %s", target.Name,
+			entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, record.RunID, configLine)
+	}
+	return restored, errs
+}
+
+// restoredEntry 返回恢复后的条目和要写入的配置行。expiry不为零值时替换描述中的过期标记，
+// 描述是配置行的最后一部分，其余部分原样保留
+func restoredEntry(record *nat.BackupRecord, expiry time.Time) (*nat.NATEntry, string) {
+	entry := *record.Entry
+	if expiry.IsZero() {
+		return &entry, record.ConfigLine
+	}
+
+	entry.Description = nat.WithExpiryTag(entry.Description, expiry)
+	line, _, _ := strings.Cut(record.ConfigLine, " description ")
+	return &entry, line + " description " + entry.Description
+}
+
+// selectBackupRecords 选出需要恢复的备份记录
+func selectBackupRecords(records []*nat.BackupRecord, routerName, globalAddress, runID string) []*nat.BackupRecord {
+	var selected []*nat.BackupRecord
+	latest := make(map[string]int) // 同一映射只恢复最近一次删除的配置
+
+	for _, record := range records {
+		if record.Entry == nil {
+			continue
+		}
+		if routerName != "" && record.Router != routerName {
+			continue
+		}
+		if runID != "" && record.RunID != runID {
+			continue
+		}
+		if globalAddress != "" && record.Entry.GetGlobalAddress() != globalAddress {
+			continue
+		}
+
+		key := record.Router + "|" + record.Entry.Protocol + "|" + record.Entry.GetGlobalAddress()
+		if idx, ok := latest[key]; ok {
+			selected[idx] = record
+			continue
+		}
+		latest[key] = len(selected)
+		selected = append(selected, record)
+	}
+	return selected
+}
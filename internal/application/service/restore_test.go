@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/description"
+	"h3c-nat-manager/internal/infrastructure/router"
+)
+
+// expiredLine newTestEnv 中已过期映射的配置行
+var expiredLine = "nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description expired-web " + expiredTag
+
+func TestRestoreMappingsE2E(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	// 更早一次删除的备份，恢复时应选择最近一次删除的配置
+	if err := env.archive.Append(&nat.BackupRecord{
+		RunID:      "20200101-000000",
+		Router:     env.svc.routers[0].Name,
+		Time:       time.Now().AddDate(-1, 0, 0),
+		Interface:  "GigabitEthernet0/0",
+		ConfigLine: "nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.200 7935 description stale " + laterTag,
+		Entry:      &nat.NATEntry{Interface: "GigabitEthernet0/0", Protocol: "TCP", GlobalIP: "117.149.14.2", GlobalPort: 7935, LocalIP: "192.168.1.200", LocalPort: 7935},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.svc.CleanupExpired(ctx); err != nil {
+		t.Fatalf("CleanupExpired() = %v", err)
+	}
+	if env.hasMapping("7935") {
+		t.Fatal("已过期的映射没有被删除")
+	}
+
+	records, err := env.archive.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].ConfigLine != expiredLine {
+		t.Fatalf("备份归档 = %+v, 期望删除前写入原配置行 %q", records, expiredLine)
+	}
+
+	// 备份中的过期标记已过，不指定新的过期日期时拒绝恢复，否则下次运行会再次删除
+	if err := env.svc.RestoreMappings(ctx, "", "117.149.14.2:7935", "", time.Time{}); err == nil {
+		t.Fatal("恢复已过期的映射时 RestoreMappings() 应返回错误")
+	}
+	if env.hasMapping("7935") || env.sim.SaveCount() != 1 {
+		t.Fatalf("已过期的映射不应被恢复: %+v", env.sim.Mappings())
+	}
+
+	// 指定新的过期日期时只替换过期标记，其余配置原样恢复
+	date := renewDate(30)
+	if err := env.svc.RestoreMappings(ctx, "", "117.149.14.2:7935", "", date); err != nil {
+		t.Fatalf("RestoreMappings() = %v", err)
+	}
+
+	restoredDescription := "expired-web vp=" + date.Format("060102")
+	if got, want := env.mappingLine("7935"), strings.TrimSuffix(expiredLine, expiredTag)+"vp="+date.Format("060102"); got != want {
+		t.Errorf("恢复后的配置行 = %q, 期望 %q", got, want)
+	}
+	if got := env.sim.SaveCount(); got != 2 {
+		t.Errorf("保存次数 = %d, 期望删除和恢复各保存一次", got)
+	}
+
+	// 重新读取时条目和描述与删除前一致
+	entries, err := env.svc.routers[0].Repo.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, entry := range entries {
+		if entry.SameMapping(records[1].Entry) {
+			found = true
+			if entry.Description != restoredDescription || entry.IsExpired(time.Now()) {
+				t.Errorf("恢复后的描述 = %q, 期望 %q", entry.Description, restoredDescription)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("重新读取的条目中没有恢复的映射: %+v", entries)
+	}
+
+	// 映射已存在时再次恢复会跳过
+	if err := env.svc.RestoreMappings(ctx, "", "", records[1].RunID, date); err == nil {
+		t.Error("映射已存在时 RestoreMappings() 应返回错误")
+	}
+}
+
+func TestRestoreMappingsDryRunE2E(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	if err := env.svc.CleanupExpired(ctx); err != nil {
+		t.Fatalf("CleanupExpired() = %v", err)
+	}
+	records, err := env.archive.Records()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("备份归档 = %+v, %v", records, err)
+	}
+
+	// 使用同一归档的演练服务只打印恢复计划
+	target := *env.svc.routers[0]
+	client, err := router.NewClient(target.Config, router.ClientOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	target.Repo = client
+	dryRun := NewNATManagerService([]*RouterTarget{&target}, env.notifier, description.NewMapper(), env.archive, env.svc.config, true)
+
+	sent := len(env.sim.Commands())
+	if err := dryRun.RestoreMappings(ctx, "", "", records[0].RunID, renewDate(30)); err != nil {
+		t.Fatalf("演练 RestoreMappings() = %v", err)
+	}
+
+	if env.hasMapping("7935") {
+		t.Error("演练模式不应恢复映射")
+	}
+	for _, cmd := range env.sim.Commands()[sent:] {
+		if cmd != "screen-length disable" && cmd != "display nat server" {
+			t.Errorf("演练模式只应读取条目，实际发送了: %q", cmd)
+		}
+	}
+	if got := env.sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 演练模式不应保存", got)
+	}
+}
+
+func TestRestoreMappingsUnexpiredE2E(t *testing.T) {
+	env := newTestEnv(t)
+	line := "nat server protocol tcp global 117.149.14.2 9100 inside 192.168.1.150 9100 description manual " + laterTag
+	if err := env.archive.Append(&nat.BackupRecord{
+		RunID:      "20260101-000000",
+		Router:     env.svc.routers[0].Name,
+		Time:       time.Now(),
+		Interface:  "GigabitEthernet0/0",
+		ConfigLine: line,
+		Entry:      &nat.NATEntry{Interface: "GigabitEthernet0/0", Protocol: "TCP", GlobalIP: "117.149.14.2", GlobalPort: 9100, LocalIP: "192.168.1.150", LocalPort: 9100, Description: "manual " + laterTag},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 尚未过期的备份不指定过期日期时原样恢复
+	if err := env.svc.RestoreMappings(context.Background(), "", "117.149.14.2:9100", "", time.Time{}); err != nil {
+		t.Fatalf("RestoreMappings() = %v", err)
+	}
+	if got := env.mappingLine("9100"); got != line {
+		t.Errorf("恢复后的配置行 = %q, 期望 %q", got, line)
+	}
+}
+
+func TestBackupRecordUsesRouterClockE2E(t *testing.T) {
+	env := newTestEnv(t)
+	env.svc.routers[0].Config.Timezone = "Asia/Shanghai"
+	asOf := time.Now().AddDate(0, 0, 1).Truncate(time.Second)
+	env.svc.routers[0].Clock = nat.FixedClock(asOf)
+
+	if err := env.svc.CleanupExpired(context.Background()); err != nil {
+		t.Fatalf("CleanupExpired() = %v", err)
+	}
+	records, err := env.archive.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || len(env.notifier.deletion) != len(records) {
+		t.Fatalf("备份 %d 条, 删除通知 %d 条, 期望一致且不为空", len(records), len(env.notifier.deletion))
+	}
+
+	// 备份时间与删除通知一样取自路由器的时钟
+	for i, record := range records {
+		if !record.Time.Equal(asOf) || !record.Time.Equal(env.notifier.deletion[i].DeleteTime) {
+			t.Errorf("备份时间 = %v, 删除时间 = %v, 期望 %v", record.Time, env.notifier.deletion[i].DeleteTime, asOf)
+		}
+	}
+
+	// 运行ID带进程号，同一秒开始的运行不会混在一起
+	if want := fmt.Sprintf("-%d", os.Getpid()); !strings.HasSuffix(records[0].RunID, want) {
+		t.Errorf("运行ID = %q, 期望以 %q 结尾", records[0].RunID, want)
+	}
+}
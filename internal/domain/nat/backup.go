@@ -0,0 +1,22 @@
+package nat
+
+import "time"
+
+// BackupRecord 删除前备份的条目配置，用于误删后恢复
+type BackupRecord struct {
+	RunID      string    `json:"run_id"`      // 删除所在的运行ID
+	Router     string    `json:"router"`      // 路由器名称
+	Time       time.Time `json:"time"`        // 备份时间
+	Interface  string    `json:"interface"`   // 配置所在接口
+	ConfigLine string    `json:"config_line"` // 路由器上原始的 nat server 配置行
+	Entry      *NATEntry `json:"entry"`       // 解析后的条目
+}
+
+// Archive 备份归档接口，只追加不修改
+type Archive interface {
+	// Append 追加一条备份记录
+	Append(record *BackupRecord) error
+
+	// Records 按写入顺序返回所有备份记录
+	Records() ([]*BackupRecord, error)
+}
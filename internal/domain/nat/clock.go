@@ -0,0 +1,24 @@
+package nat
+
+import "time"
+
+// Clock 提供判断过期使用的当前时间，测试和 --as-of 演练时可以替换
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 系统时钟
+type SystemClock struct{}
+
+// Now 返回系统当前时间
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock 固定在某一时刻的时钟
+type FixedClock time.Time
+
+// Now 返回固定的时刻
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
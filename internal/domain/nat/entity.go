@@ -1,6 +1,8 @@
 package nat
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -8,98 +10,134 @@ import (
 
 // NATEntry NAT映射条目实体
 type NATEntry struct {
-	Interface   string     // 接口名称 如: GigabitEthernet0/0
-	Protocol    string     // 协议类型 TCP/UDP
-	GlobalIP    string     // 外网IP
-	GlobalPort  int        // 外网端口
-	LocalIP     string     // 内网IP
-	LocalPort   int        // 内网端口
-	Description string     // 原始描述
-	Status      string     // 配置状态 Active/Inactive
-	ExpiryDate  *time.Time // 过期时间
+	Router          string     // 所属路由器名称
+	Interface       string     // 接口名称 如: GigabitEthernet0/0
+	Protocol        string     // 协议类型 TCP/UDP/ICMP/ANY，未知协议为协议号
+	GlobalIP        string     // 外网IP，使用接口地址且未获取到时为空
+	GlobalIPEnd     string     // 外网IP范围结束，非范围时为空
+	GlobalPort      int        // 外网端口
+	GlobalPortEnd   int        // 外网端口范围结束，非范围时为0
+	GlobalInterface string     // 使用接口地址作为外网地址时的接口，current-interface 或接口名
+	GlobalVPN       string     // 外网VPN实例
+	LocalIP         string     // 内网IP
+	LocalIPEnd      string     // 内网IP范围结束，非范围时为空
+	LocalPort       int        // 内网端口
+	LocalPortEnd    int        // 内网端口范围结束，非范围时为0
+	LocalVPN        string     // 内网VPN实例
+	ACL             string     // 关联的ACL编号
+	RuleName        string     // 规则名称
+	Description     string     // 原始描述
+	Status          string     // 配置状态 Active/Inactive
+	ExpiryDate      *time.Time // 过期时间
+	InvalidExpiry   string     // vp= 标记无效的原因，为空表示没有标记或标记有效
+	Owner           string     // 负责人，描述中的 own= 标记
+	Ticket          string     // 工单号，描述中的 tk= 标记
+	Group           string     // 通知群组，描述中的 grp= 标记
+	Keep            bool       // 受保护，描述中带 keep 标记时过期后不自动删除
 }
 
-// HasExpiryInfo 检查是否包含过期信息
+// HasExpiryInfo 检查是否包含过期信息，即 vp= 或 ttl= 标记
 func (n *NATEntry) HasExpiryInfo() bool {
-	return strings.Contains(n.Description, "vp=")
+	meta := ParseMetadata(n.Description)
+	return meta.hasExpiry() || meta.TTL != ""
 }
 
-// ParseExpiryDate 从描述中解析过期时间
-func (n *NATEntry) ParseExpiryDate() error {
-	return n.ParseExpiryDateWithTime(21, 30) // 默认21:30
+// HasInvalidExpiry 检查过期标记是否无效，无效标记的条目不会过期，需要人工修正
+func (n *NATEntry) HasInvalidExpiry() bool {
+	return n.InvalidExpiry != ""
 }
 
-// ParseExpiryDateWithTime 从描述中解析过期时间，使用指定的小时和分钟
-func (n *NATEntry) ParseExpiryDateWithTime(hour, minute int) error {
-	if !n.HasExpiryInfo() {
-		return nil
-	}
+// ParseDescription 解析描述中的标记，填入负责人、工单号、群组、保护标记和过期时间，
+// 过期时间使用指定的小时和分钟，按loc时区解析
+func (n *NATEntry) ParseDescription(hour, minute int, loc *time.Location) error {
+	meta := ParseMetadata(n.Description)
+	n.Owner = meta.Owner
+	n.Ticket = meta.Ticket
+	n.Group = meta.Group
+	n.Keep = meta.Keep
+	return n.ParseExpiryDateWithTime(hour, minute, loc)
+}
 
-	// 查找vp=YYMMDD格式
-	parts := strings.Split(n.Description, "vp=")
-	if len(parts) < 2 {
-		return nil
-	}
+// ParseExpiryDate 从描述中解析过期时间
+func (n *NATEntry) ParseExpiryDate() error {
+	return n.ParseExpiryDateWithTime(21, 30, time.Local) // 默认21:30
+}
 
-	dateStr := strings.TrimSpace(parts[1])
-	if len(dateStr) < 6 {
-		return nil
+// ParseExpiryDateWithTime 从描述中解析过期时间，标记中没有时分时使用指定的小时和分钟，
+// 标记中的日期时间按loc时区解析，为nil时使用系统时区，规则见 expiry.go。
+// 标记无效时不设置过期时间，在 InvalidExpiry 中记录原因并返回 ErrInvalidExpiryTag
+func (n *NATEntry) ParseExpiryDateWithTime(hour, minute int, loc *time.Location) error {
+	n.ExpiryDate = nil
+	n.InvalidExpiry = ""
+	if loc == nil {
+		loc = time.Local
 	}
 
-	// 取前6位作为日期
-	dateStr = dateStr[:6]
-	
-	// 解析YYMMDD格式
-	year, err := strconv.Atoi("20" + dateStr[:2])
-	if err != nil {
-		return err
-	}
-	
-	month, err := strconv.Atoi(dateStr[2:4])
+	expiryDate, err := expiryFromMetadata(ParseMetadata(n.Description), hour, minute, loc)
 	if err != nil {
-		return err
-	}
-	
-	day, err := strconv.Atoi(dateStr[4:6])
-	if err != nil {
-		return err
+		n.InvalidExpiry = err.Error()
+		return fmt.Errorf("%w: %s", ErrInvalidExpiryTag, n.InvalidExpiry)
 	}
+	n.ExpiryDate = expiryDate
 
-	// 使用配置的过期时间
-	expiryDate := time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.Local)
-	n.ExpiryDate = &expiryDate
-	
 	return nil
 }
 
-// IsExpired 检查是否已过期
-func (n *NATEntry) IsExpired() bool {
+// IsExpired 检查在now时是否已过期
+func (n *NATEntry) IsExpired(now time.Time) bool {
 	if n.ExpiryDate == nil {
 		return false
 	}
-	
+
 	// 直接比较当前时间和过期时间
-	return time.Now().After(*n.ExpiryDate)
+	return now.After(*n.ExpiryDate)
 }
 
-// WillExpireIn 检查是否在指定天数内过期（不包括已过期的）
-func (n *NATEntry) WillExpireIn(days int) bool {
+// WillExpireIn 检查从now起是否在指定天数内过期（不包括已过期的）
+func (n *NATEntry) WillExpireIn(now time.Time, days int) bool {
 	if n.ExpiryDate == nil {
 		return false
 	}
-	
+
 	// 如果已经过期，不需要通知
-	if n.IsExpired() {
+	if n.IsExpired(now) {
 		return false
 	}
-	
-	// 检查是否在指定天数内过期
-	now := time.Now()
-	checkDate := now.AddDate(0, 0, days)
-	
+
+	// 在过期时间所在的时区按天计算，不受夏令时和运行机器时区的影响
+	checkDate := now.In(n.ExpiryDate.Location()).AddDate(0, 0, days)
+
 	return n.ExpiryDate.Before(checkDate) || n.ExpiryDate.Equal(checkDate)
 }
 
+// expiryTagPattern 匹配描述中的过期标记，包括与 vp= 之间多了空格的日期
+var expiryTagPattern = regexp.MustCompile(`vp=(?:\S+|\s+\d\S*)?`)
+
+// DescriptionText 返回去掉标记后的描述文本
+func (n *NATEntry) DescriptionText() string {
+	return ParseMetadata(n.Description).Text
+}
+
+// FormatExpiryTag 生成 vp=YYMMDD 过期标记
+func FormatExpiryTag(date time.Time) string {
+	return "vp=" + date.Format("060102")
+}
+
+// WithExpiryTag 替换描述中的过期标记，没有时追加到末尾。
+// 原标记的日期格式和其中的时分保持不变，只替换日期，见 formatTagLike
+func WithExpiryTag(description string, date time.Time) string {
+	tag := FormatExpiryTag(date)
+	if expiryTagPattern.MatchString(description) {
+		return expiryTagPattern.ReplaceAllStringFunc(description, func(old string) string {
+			return TagExpiry + "=" + formatTagLike(strings.TrimSpace(old[len(TagExpiry)+1:]), date)
+		})
+	}
+	if description == "" {
+		return tag
+	}
+	return description + " " + tag
+}
+
 // GetGlobalAddress 获取外网地址端口组合
 func (n *NATEntry) GetGlobalAddress() string {
 	return n.GlobalIP + ":" + strconv.Itoa(n.GlobalPort)
@@ -108,4 +146,16 @@ func (n *NATEntry) GetGlobalAddress() string {
 // GetLocalAddress 获取内网地址端口组合
 func (n *NATEntry) GetLocalAddress() string {
 	return n.LocalIP + ":" + strconv.Itoa(n.LocalPort)
-}
\ No newline at end of file
+}
+
+// SameMapping 判断两个条目是否为路由器上的同一条映射
+func (n *NATEntry) SameMapping(other *NATEntry) bool {
+	return n.Interface == other.Interface &&
+		n.Protocol == other.Protocol &&
+		n.GlobalIP == other.GlobalIP && n.GlobalIPEnd == other.GlobalIPEnd &&
+		n.GlobalPort == other.GlobalPort && n.GlobalPortEnd == other.GlobalPortEnd &&
+		n.GlobalInterface == other.GlobalInterface && n.GlobalVPN == other.GlobalVPN &&
+		n.LocalIP == other.LocalIP && n.LocalIPEnd == other.LocalIPEnd &&
+		n.LocalPort == other.LocalPort && n.LocalPortEnd == other.LocalPortEnd &&
+		n.LocalVPN == other.LocalVPN
+}
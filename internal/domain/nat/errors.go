@@ -0,0 +1,20 @@
+package nat
+
+import "errors"
+
+// 路由器命令执行失败的错误类型，基础设施层返回的错误应包装这些类型
+var (
+	// ErrEntryNotFound 条目在路由器上不存在
+	ErrEntryNotFound = errors.New("NAT条目不存在")
+	// ErrCommandSyntax 命令语法错误或参数不完整
+	ErrCommandSyntax = errors.New("命令语法错误")
+	// ErrPermissionDenied 账号没有执行该命令的权限
+	ErrPermissionDenied = errors.New("权限不足")
+	// ErrResourceBusy 设备忙或配置被占用，可稍后重试
+	ErrResourceBusy = errors.New("设备忙")
+	// ErrCommandFailed 其他无法归类的命令错误
+	ErrCommandFailed = errors.New("命令执行失败")
+)
+
+// ErrInvalidExpiryTag 描述中的 vp= 过期标记不是有效日期
+var ErrInvalidExpiryTag = errors.New("过期标记无效")
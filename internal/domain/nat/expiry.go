@@ -0,0 +1,149 @@
+package nat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// 过期时间按以下优先级确定：
+//
+//  1. vp= 明确的过期时间，支持以下格式：
+//     YYMMDD            260112            年份按20YY计算，时分使用路由器配置的 expiry_time
+//     YYYYMMDD          20260112          时分使用 expiry_time
+//     YYMMDDHHMM        2601121800        使用条目自己的时分
+//     YYYY-MM-DD        2026-01-12        ISO日期，时分使用 expiry_time
+//     YYYY-MM-DDTHH:MM  2026-01-12T18:00  ISO日期和条目自己的时分
+//  2. ttl= 相对有效期，从 ct= 记录的创建时间起算，如 ct=260112 ttl=30d，单位为 d(天) 或 w(周)。
+//     ct= 支持与 vp= 相同的格式，到期的时分取 ct= 中的时分，没有时使用 expiry_time
+//
+// 同时有 vp= 和 ttl= 时以 vp= 为准；有 ttl= 而没有 ct= 时标记无效。
+// 所有时间都是路由器所在时区（配置的 timezone）的本地时间。
+
+// 日期格式
+var (
+	compactDatePattern = regexp.MustCompile(`^\d+$`)
+	isoDatePattern     = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})(?:T(\d{2}):(\d{2}))?$`)
+	ttlPattern         = regexp.MustCompile(`^(\d+)([dw])$`)
+)
+
+// expiryFromMetadata 按优先级从标记计算过期时间，没有过期标记时返回nil；
+// 标记无效时返回的错误为 "标记=值 原因" 形式，用于提示修正
+func expiryFromMetadata(meta Metadata, hour, minute int, loc *time.Location) (*time.Time, error) {
+	if meta.ExpiryError != "" {
+		return nil, fmt.Errorf("%s= %s", TagExpiry, meta.ExpiryError)
+	}
+	if meta.Expiry != "" {
+		expiry, err := parseTagDate(meta.Expiry, hour, minute, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s=%s %v", TagExpiry, meta.Expiry, err)
+		}
+		return &expiry, nil
+	}
+
+	if meta.TTL == "" {
+		return nil, nil
+	}
+	days, err := parseTTL(meta.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s=%s %v", TagTTL, meta.TTL, err)
+	}
+	if meta.Created == "" {
+		return nil, fmt.Errorf("%s=%s 缺少 %s= 创建日期", TagTTL, meta.TTL, TagCreated)
+	}
+	created, err := parseTagDate(meta.Created, hour, minute, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s=%s %v", TagCreated, meta.Created, err)
+	}
+
+	expiry := created.AddDate(0, 0, days)
+	return &expiry, nil
+}
+
+// parseTagDate 解析 vp=、ct= 的日期为loc时区的时间，日期中没有时分时使用指定的小时和分钟
+func parseTagDate(value string, hour, minute int, loc *time.Location) (time.Time, error) {
+	if compactDatePattern.MatchString(value) {
+		number := func(start, end int) int {
+			n, _ := strconv.Atoi(value[start:end])
+			return n
+		}
+
+		switch len(value) {
+		case 6:
+			return makeDate(2000+number(0, 2), number(2, 4), number(4, 6), hour, minute, loc)
+		case 8:
+			return makeDate(number(0, 4), number(4, 6), number(6, 8), hour, minute, loc)
+		case 10:
+			return makeDate(2000+number(0, 2), number(2, 4), number(4, 6), number(6, 8), number(8, 10), loc)
+		}
+	}
+
+	if m := isoDatePattern.FindStringSubmatch(value); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		if m[4] != "" {
+			hour, _ = strconv.Atoi(m[4])
+			minute, _ = strconv.Atoi(m[5])
+		}
+		return makeDate(year, month, day, hour, minute, loc)
+	}
+
+	return time.Time{}, fmt.Errorf("格式应为YYMMDD、YYYYMMDD、YYMMDDHHMM或YYYY-MM-DD")
+}
+
+// makeDate 生成loc时区的时间，要求日期和时分原样存在
+func makeDate(year, month, day, hour, minute int, loc *time.Location) (time.Time, error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return time.Time{}, fmt.Errorf("时间不存在")
+	}
+
+	// time.Date 会把 13月、2月30日等顺延到之后的日期，这里要求日期原样存在
+	date := time.Date(year, time.Month(month), day, hour, minute, 0, 0, loc)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return time.Time{}, fmt.Errorf("日期不存在")
+	}
+	return date, nil
+}
+
+// parseTTL 解析 ttl= 的值，返回天数
+func parseTTL(value string) (int, error) {
+	m := ttlPattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("格式应为天数加单位，如 30d 或 4w")
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("有效期必须大于0")
+	}
+	if m[2] == "w" {
+		n *= 7
+	}
+	return n, nil
+}
+
+// formatTagLike 按原标记值的格式写入新日期，原值带时分时保留时分；原值无效时使用 YYMMDD
+func formatTagLike(old string, date time.Time) string {
+	if compactDatePattern.MatchString(old) {
+		switch len(old) {
+		case 8:
+			return date.Format("20060102")
+		case 10:
+			return date.Format("060102") + old[6:]
+		}
+	}
+	if m := isoDatePattern.FindStringSubmatch(old); m != nil {
+		if m[4] != "" {
+			return date.Format("2006-01-02") + old[10:]
+		}
+		return date.Format("2006-01-02")
+	}
+	return date.Format("060102")
+}
+
+// FormatCreatedTag 生成 ct=YYMMDD 创建日期标记，date应已转换到路由器时区
+func FormatCreatedTag(date time.Time) string {
+	return TagCreated + "=" + date.Format("060102")
+}
@@ -0,0 +1,132 @@
+package nat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiryFormats(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string // 期望的过期时间，为空表示没有过期时间
+		invalid     string // 期望的无效原因
+	}{
+		{"vp=260112", "2026-01-12 21:30", ""},
+		{"vp=20260112", "2026-01-12 21:30", ""},
+		{"vp=2601121800", "2026-01-12 18:00", ""},
+		{"vp=2026-01-12", "2026-01-12 21:30", ""},
+		{"vp=2026-01-12T08:05", "2026-01-12 08:05", ""},
+		{"ct=260101 ttl=30d", "2026-01-31 21:30", ""},
+		{"ct=2601010900 ttl=2w", "2026-01-15 09:00", ""},
+		{"ct=2025-12-31 ttl=1d", "2026-01-01 21:30", ""},
+		// vp= 优先于 ttl=
+		{"ct=260101 ttl=30d vp=260301", "2026-03-01 21:30", ""},
+		{"vp=260301 ttl=bad", "2026-03-01 21:30", ""},
+		{"own=a", "", ""},
+		{"ct=260101", "", ""},
+
+		{"vp=2601122400", "", "vp=2601122400 时间不存在"},
+		{"vp=20261301", "", "vp=20261301 日期不存在"},
+		{"vp=2026-02-30", "", "vp=2026-02-30 日期不存在"},
+		{"vp=26-01-12", "", "vp=26-01-12 格式应为YYMMDD、YYYYMMDD、YYMMDDHHMM或YYYY-MM-DD"},
+		{"ttl=30d", "", "ttl=30d 缺少 ct= 创建日期"},
+		{"ct=260101 ttl=30", "", "ttl=30 格式应为天数加单位，如 30d 或 4w"},
+		{"ct=260101 ttl=0d", "", "ttl=0d 有效期必须大于0"},
+		{"ct=261301 ttl=30d", "", "ct=261301 日期不存在"},
+	}
+
+	for _, tt := range tests {
+		entry := &NATEntry{Description: tt.description}
+		entry.ParseExpiryDateWithTime(21, 30, time.Local)
+
+		got := ""
+		if entry.ExpiryDate != nil {
+			got = entry.ExpiryDate.Format("2006-01-02 15:04")
+		}
+		if got != tt.want || entry.InvalidExpiry != tt.invalid {
+			t.Errorf("%q: 过期时间 %q, 无效原因 %q, 期望 %q, %q", tt.description, got, entry.InvalidExpiry, tt.want, tt.invalid)
+		}
+	}
+}
+
+func TestExpiryWithClock(t *testing.T) {
+	entry := &NATEntry{Description: "vp=260112"}
+	entry.ParseExpiryDateWithTime(21, 30, time.Local)
+
+	tests := []struct {
+		now        string
+		expired    bool
+		willExpire bool
+	}{
+		{"2026-01-01 09:00", false, false},
+		{"2026-01-06 09:00", false, true},
+		{"2026-01-12 21:30", false, true}, // 到达过期时间的那一刻还未过期
+		{"2026-01-12 21:31", true, false},
+	}
+	for _, tt := range tests {
+		now, _ := time.ParseInLocation("2006-01-02 15:04", tt.now, time.Local)
+		clock := FixedClock(now)
+		if got := entry.IsExpired(clock.Now()); got != tt.expired {
+			t.Errorf("%s: IsExpired = %v, 期望 %v", tt.now, got, tt.expired)
+		}
+		if got := entry.WillExpireIn(clock.Now(), 7); got != tt.willExpire {
+			t.Errorf("%s: WillExpireIn(7) = %v, 期望 %v", tt.now, got, tt.willExpire)
+		}
+	}
+}
+
+func TestExpiryTimezone(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := &NATEntry{Description: "vp=260112"}
+	local.ParseExpiryDateWithTime(21, 30, shanghai)
+	utc := &NATEntry{Description: "vp=260112"}
+	utc.ParseExpiryDateWithTime(21, 30, time.UTC)
+
+	// 同一标记在东八区比UTC早8小时到期
+	if got := utc.ExpiryDate.Sub(*local.ExpiryDate); got != 8*time.Hour {
+		t.Errorf("UTC与东八区的过期时间相差 %v, 期望 8h", got)
+	}
+
+	// 运行机器为UTC时，按路由器时区判断：北京时间22:00已过期
+	now := time.Date(2026, 1, 12, 14, 0, 0, 0, time.UTC)
+	if !local.IsExpired(now) || utc.IsExpired(now) {
+		t.Errorf("%v: 东八区 IsExpired = %v, UTC IsExpired = %v", now, local.IsExpired(now), utc.IsExpired(now))
+	}
+
+	// 7天后为北京时间1月12日22:00，东八区的条目进入提醒范围，UTC的条目还没有
+	now = time.Date(2026, 1, 5, 14, 0, 0, 0, time.UTC)
+	if !local.WillExpireIn(now, 7) || utc.WillExpireIn(now, 7) {
+		t.Errorf("%v: 东八区 WillExpireIn(7) = %v, UTC WillExpireIn(7) = %v", now, local.WillExpireIn(now, 7), utc.WillExpireIn(now, 7))
+	}
+}
+
+func TestWithExpiryTagKeepsFormat(t *testing.T) {
+	date := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"web vp=260112", "web vp=260301"},
+		{"web vp=20260112", "web vp=20260301"},
+		{"web vp=2601121800 own=a", "web vp=2603011800 own=a"},
+		{"web vp=2026-01-12", "web vp=2026-03-01"},
+		{"web vp=2026-01-12T08:05", "web vp=2026-03-01T08:05"},
+		{"巡检-vp=260112", "巡检-vp=260301"},
+		// 原标记无效时写入默认格式
+		{"web vp=2601", "web vp=260301"},
+		{"web vp= own=a", "web vp=260301 own=a"},
+		{"web vp= 260112 own=a", "web vp=260301 own=a"},
+		{"web", "web vp=260301"},
+		{"", "vp=260301"},
+	}
+
+	for _, tt := range tests {
+		if got := WithExpiryTag(tt.description, date); got != tt.want {
+			t.Errorf("WithExpiryTag(%q) = %q, 期望 %q", tt.description, got, tt.want)
+		}
+	}
+}
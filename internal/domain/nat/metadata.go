@@ -0,0 +1,116 @@
+package nat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 描述中的标记
+const (
+	TagExpiry  = "vp"   // 过期时间，格式见 expiry.go
+	TagCreated = "ct"   // 创建时间，ttl= 从此时起算
+	TagTTL     = "ttl"  // 相对有效期，如 30d
+	TagOwner   = "own"  // 负责人
+	TagTicket  = "tk"   // 工单号
+	TagGroup   = "grp"  // 通知群组，对应钉钉配置 groups 中的名称
+	TagKeep    = "keep" // 受保护的条目，过期后不自动删除
+)
+
+// Metadata 从描述中解析出的标记
+type Metadata struct {
+	Expiry      string // vp= 的值
+	ExpiryError string // vp= 后没有日期的原因，按无效的过期标记处理
+	Created     string // ct= 的值
+	TTL         string // ttl= 的值
+	Owner       string // own= 的值
+	Ticket      string // tk= 的值
+	Group       string // grp= 的值
+	Keep        bool   // 是否带 keep 标记
+	Text        string // 去掉标记后的描述文本
+}
+
+// ParseMetadata 解析描述中的标记。
+//
+// 描述按空白分隔为词，key=value 形式且 key 为 vp、ct、ttl、own、tk、grp 的词，以及单独的 keep 是标记，
+// 其余词按原顺序组成描述文本。同一标记出现多次时以第一个为准；值为空的 key= 不是标记，
+// 但 vp= 例外：值为空的 vp= 是写错的过期标记，记录在 ExpiryError 中，其后紧跟的日期（如 vp= 260112）一并去掉。
+// 为兼容旧描述，紧跟在其他文字后的 vp=（如 web-vp=260112）也视为过期标记
+func ParseMetadata(description string) Metadata {
+	var meta Metadata
+	var text []string
+
+	words := strings.Fields(description)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == TagKeep {
+			meta.Keep = true
+			continue
+		}
+
+		if prefix, ok := strings.CutSuffix(word, TagExpiry+"="); ok {
+			reason := "缺少日期"
+			if i+1 < len(words) && isDigit(words[i+1][0]) {
+				i++
+				reason = fmt.Sprintf("与日期 %s 之间不能有空格", words[i])
+			}
+			if !meta.hasExpiry() {
+				meta.ExpiryError = reason
+			}
+			if prefix != "" {
+				text = append(text, prefix)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(word, "=")
+		if ok && value != "" {
+			if field := meta.field(key); field != nil {
+				if *field == "" && (key != TagExpiry || !meta.hasExpiry()) {
+					*field = value
+				}
+				continue
+			}
+		}
+
+		if i := strings.Index(word, TagExpiry+"="); i > 0 && len(word) > i+len(TagExpiry)+1 {
+			if !meta.hasExpiry() {
+				meta.Expiry = word[i+len(TagExpiry)+1:]
+			}
+			word = word[:i]
+		}
+		text = append(text, word)
+	}
+
+	meta.Text = strings.Trim(strings.Join(text, " "), " \t-_,;")
+	return meta
+}
+
+// hasExpiry 是否已有过期标记，包括写错的 vp=
+func (m *Metadata) hasExpiry() bool {
+	return m.Expiry != "" || m.ExpiryError != ""
+}
+
+// field 返回标记key对应的字段，不是带值的标记时返回nil
+func (m *Metadata) field(key string) *string {
+	switch key {
+	case TagExpiry:
+		return &m.Expiry
+	case TagCreated:
+		return &m.Created
+	case TagTTL:
+		return &m.TTL
+	case TagOwner:
+		return &m.Owner
+	case TagTicket:
+		return &m.Ticket
+	case TagGroup:
+		return &m.Group
+	default:
+		return nil
+	}
+}
+
+// isDigit 判断字节是否为数字
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
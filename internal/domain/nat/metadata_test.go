@@ -0,0 +1,98 @@
+package nat
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		description string
+		want        Metadata
+	}{
+		{"", Metadata{}},
+		{"测试服务 vp=991231", Metadata{Expiry: "991231", Text: "测试服务"}},
+		{"web own=zhangsan tk=OPS-1024 grp=inspection vp=260112 keep",
+			Metadata{Expiry: "260112", Owner: "zhangsan", Ticket: "OPS-1024", Group: "inspection", Keep: true, Text: "web"}},
+		// 旧描述中紧跟在文字后的过期标记
+		{"巡检-vp=260112", Metadata{Expiry: "260112", Text: "巡检"}},
+		// 同一标记以第一个为准
+		{"vp=260112 vp=270101 own=a own=b", Metadata{Expiry: "260112", Owner: "a"}},
+		// 值为空或未知的key不是标记
+		{"a own= x=1 keeper", Metadata{Text: "a own= x=1 keeper"}},
+		// 值为空的 vp= 是写错的过期标记，之后的 vp= 不再生效
+		{"web vp= own=a", Metadata{ExpiryError: "缺少日期", Owner: "a", Text: "web"}},
+		{"web vp=", Metadata{ExpiryError: "缺少日期", Text: "web"}},
+		{"web vp= 260112 vp=270101", Metadata{ExpiryError: "与日期 260112 之间不能有空格", Text: "web"}},
+		{"巡检-vp= 260112", Metadata{ExpiryError: "与日期 260112 之间不能有空格", Text: "巡检"}},
+		// 已有过期标记时忽略之后写错的 vp=
+		{"vp=260112 vp=", Metadata{Expiry: "260112"}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseMetadata(tt.description); got != tt.want {
+			t.Errorf("ParseMetadata(%q) = %+v, 期望 %+v", tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestParseDescription(t *testing.T) {
+	entry := &NATEntry{Description: "db own=lisi tk=42 keep vp=260112"}
+	if err := entry.ParseDescription(21, 30, time.Local); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Owner != "lisi" || entry.Ticket != "42" || !entry.Keep || entry.Group != "" {
+		t.Errorf("标记字段 = %+v", entry)
+	}
+	if entry.ExpiryDate == nil || entry.ExpiryDate.Format("2006-01-02 15:04") != "2026-01-12 21:30" {
+		t.Errorf("ExpiryDate = %v, 期望 2026-01-12 21:30", entry.ExpiryDate)
+	}
+	if got := entry.DescriptionText(); got != "db" {
+		t.Errorf("DescriptionText() = %q, 期望 %q", got, "db")
+	}
+}
+
+func TestParseExpiryDateInvalid(t *testing.T) {
+	for _, description := range []string{"vp=2601", "vp=2601123", "vp=26011a", "vp=261345", "vp=260230", "vp=260100", "vp=", "vp= 260112"} {
+		entry := &NATEntry{Description: "web " + description}
+		err := entry.ParseExpiryDateWithTime(21, 30, time.Local)
+		if !errors.Is(err, ErrInvalidExpiryTag) {
+			t.Errorf("%s: err = %v, 期望 ErrInvalidExpiryTag", description, err)
+		}
+		if entry.ExpiryDate != nil || !entry.HasInvalidExpiry() || !entry.HasExpiryInfo() {
+			t.Errorf("%s: ExpiryDate = %v, InvalidExpiry = %q", description, entry.ExpiryDate, entry.InvalidExpiry)
+		}
+		if entry.IsExpired(time.Now()) || entry.WillExpireIn(time.Now(), 3650) {
+			t.Errorf("%s: 标记无效的条目不应过期", description)
+		}
+	}
+
+	// 闰年的2月29日是有效日期
+	entry := &NATEntry{Description: "vp=280229"}
+	if err := entry.ParseExpiryDateWithTime(21, 30, time.Local); err != nil || entry.HasInvalidExpiry() {
+		t.Errorf("vp=280229: err = %v, InvalidExpiry = %q", err, entry.InvalidExpiry)
+	}
+}
+
+func TestParseExpiryDateMissingValue(t *testing.T) {
+	tests := []struct {
+		description string
+		reason      string
+	}{
+		{"web vp=", "vp= 缺少日期"},
+		{"web vp= 260112", "vp= 与日期 260112 之间不能有空格"},
+		// 同时有 ttl= 时 vp= 仍优先，写错时不按 ttl= 计算
+		{"web vp= ct=260101 ttl=30d", "vp= 缺少日期"},
+	}
+
+	for _, tt := range tests {
+		entry := &NATEntry{Description: tt.description}
+		if err := entry.ParseExpiryDateWithTime(21, 30, time.Local); !errors.Is(err, ErrInvalidExpiryTag) {
+			t.Errorf("%s: err = %v, 期望 ErrInvalidExpiryTag", tt.description, err)
+		}
+		if entry.InvalidExpiry != tt.reason {
+			t.Errorf("%s: InvalidExpiry = %q, 期望 %q", tt.description, entry.InvalidExpiry, tt.reason)
+		}
+	}
+}
@@ -1,10 +1,30 @@
 package nat
 
-// Repository NAT仓储接口
+import (
+	"context"
+	"time"
+)
+
+// Repository NAT仓储接口，ctx取消时尚未完成的网络操作会中断
 type Repository interface {
 	// GetAllEntries 获取所有NAT映射条目
-	GetAllEntries() ([]*NATEntry, error)
-	
+	GetAllEntries(ctx context.Context) ([]*NATEntry, error)
+
+	// CreateEntry 创建NAT映射条目，调用方负责校验和冲突检查
+	CreateEntry(ctx context.Context, entry *NATEntry) error
+
 	// DeleteEntry 删除指定的NAT映射条目
-	DeleteEntry(entry *NATEntry) error
-}
\ No newline at end of file
+	DeleteEntry(ctx context.Context, entry *NATEntry) error
+
+	// RenewEntry 将条目描述中的过期标记改为新日期，保留描述的其余部分
+	RenewEntry(ctx context.Context, entry *NATEntry, expiry time.Time) error
+
+	// BackupEntry 返回条目在设备上的原始配置行，删除前用于备份
+	BackupEntry(ctx context.Context, entry *NATEntry) (string, error)
+
+	// RestoreEntry 在指定接口上重新应用备份的配置行
+	RestoreEntry(ctx context.Context, interfaceName, configLine string) error
+
+	// SaveConfig 将当前配置保存为设备启动配置，使修改在重启后仍然生效
+	SaveConfig(ctx context.Context) error
+}
@@ -0,0 +1,112 @@
+package nat
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MaxDescriptionLength Comware nat server 描述的最大长度，按设备编码后的字节数计算
+const MaxDescriptionLength = 63
+
+// Validate 校验新建条目的字段，描述长度与路由器编码有关，由仓储用 ValidateDescriptionLength 检查
+func (n *NATEntry) Validate() error {
+	if n.Interface == "" {
+		return fmt.Errorf("接口不能为空")
+	}
+
+	switch n.Protocol {
+	case "TCP", "UDP":
+		if err := validatePortRange(n.GlobalPort, n.GlobalPortEnd); err != nil {
+			return fmt.Errorf("外网%v", err)
+		}
+		if err := validatePortRange(n.LocalPort, n.LocalPortEnd); err != nil {
+			return fmt.Errorf("内网%v", err)
+		}
+		if n.LocalPortEnd != 0 && n.LocalPortEnd-n.LocalPort != n.GlobalPortEnd-n.GlobalPort {
+			return fmt.Errorf("内外网端口范围大小不一致")
+		}
+	case "":
+		return fmt.Errorf("协议不能为空")
+	default:
+		return fmt.Errorf("仅支持创建TCP/UDP映射，当前协议: %s", n.Protocol)
+	}
+
+	if n.GlobalInterface == "" && net.ParseIP(n.GlobalIP).To4() == nil {
+		return fmt.Errorf("无效的外网IP: %s", n.GlobalIP)
+	}
+	if net.ParseIP(n.LocalIP).To4() == nil {
+		return fmt.Errorf("无效的内网IP: %s", n.LocalIP)
+	}
+
+	if !n.HasExpiryInfo() {
+		return fmt.Errorf("描述中缺少 vp= 或 ttl= 过期标记")
+	}
+	if strings.ContainsAny(n.Description, "\r\n?") {
+		return fmt.Errorf("描述不能包含换行或问号")
+	}
+
+	return nil
+}
+
+// ValidateDescriptionLength 校验描述长度，encodedLen为描述按路由器编码后的字节数
+func ValidateDescriptionLength(description string, encodedLen int) error {
+	if encodedLen > MaxDescriptionLength {
+		return fmt.Errorf("描述编码后为 %d 字节，不能超过 %d 字节: %s", encodedLen, MaxDescriptionLength, description)
+	}
+	return nil
+}
+
+// validatePortRange 校验端口及端口范围
+func validatePortRange(start, end int) error {
+	if start < 1 || start > 65535 {
+		return fmt.Errorf("端口必须在1-65535之间，当前值: %d", start)
+	}
+	if end != 0 && (end < start || end > 65535) {
+		return fmt.Errorf("无效的端口范围: %d-%d", start, end)
+	}
+	return nil
+}
+
+// ConflictsWith 判断两个条目的外网地址端口是否冲突
+func (n *NATEntry) ConflictsWith(other *NATEntry) bool {
+	if n.GlobalVPN != other.GlobalVPN {
+		return false
+	}
+
+	// 使用接口地址时按接口比较，否则按外网IP比较
+	if n.GlobalInterface != "" || other.GlobalInterface != "" {
+		if n.globalInterfaceName() != other.globalInterfaceName() {
+			return false
+		}
+	} else if n.GlobalIP != other.GlobalIP {
+		return false
+	}
+
+	if n.Protocol != other.Protocol && n.Protocol != "ANY" && other.Protocol != "ANY" {
+		return false
+	}
+
+	// 没有端口的协议占用整个外网地址
+	if n.GlobalPort == 0 || other.GlobalPort == 0 {
+		return true
+	}
+
+	return n.globalPortEnd() >= other.GlobalPort && other.globalPortEnd() >= n.GlobalPort
+}
+
+// globalInterfaceName 返回外网地址所属接口，current-interface 即条目所在接口
+func (n *NATEntry) globalInterfaceName() string {
+	if n.GlobalInterface == "current-interface" {
+		return n.Interface
+	}
+	return n.GlobalInterface
+}
+
+// globalPortEnd 返回外网端口范围的结束端口
+func (n *NATEntry) globalPortEnd() int {
+	if n.GlobalPortEnd != 0 {
+		return n.GlobalPortEnd
+	}
+	return n.GlobalPort
+}
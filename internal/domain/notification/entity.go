@@ -7,29 +7,66 @@ import (
 
 // ExpiryNotification 过期通知实体
 type ExpiryNotification struct {
+	Source        string    // 消息来源路由器
 	GlobalAddress string    // 外网地址端口
 	LocalAddress  string    // 内网地址端口
 	Protocol      string    // 协议类型
 	Description   string    // 服务描述
+	Owner         string    // 负责人，描述中的 own= 标记
+	Ticket        string    // 工单号，描述中的 tk= 标记
+	Group         string    // 通知群组，描述中的 grp= 标记，为空时按服务器IP选择群组
 	ExpiryDate    time.Time // 到期时间
 	NotifyTime    time.Time // 通知时间
 }
 
 // DeletionNotification 删除通知实体
 type DeletionNotification struct {
+	Source        string    // 消息来源路由器
 	GlobalAddress string    // 外网地址端口
 	LocalAddress  string    // 内网地址端口
 	Protocol      string    // 协议类型
 	Description   string    // 服务描述
+	Owner         string    // 负责人，描述中的 own= 标记
+	Ticket        string    // 工单号，描述中的 tk= 标记
+	Group         string    // 通知群组，描述中的 grp= 标记，为空时按服务器IP选择群组
 	ExpiryDate    time.Time // 到期时间
 	DeleteTime    time.Time // 删除时间
 }
 
+// RenewalNotification 续期通知实体
+type RenewalNotification struct {
+	Source        string    // 消息来源路由器
+	GlobalAddress string    // 外网地址端口
+	LocalAddress  string    // 内网地址端口
+	Protocol      string    // 协议类型
+	Description   string    // 服务描述
+	Owner         string    // 负责人，描述中的 own= 标记
+	Ticket        string    // 工单号，描述中的 tk= 标记
+	Group         string    // 通知群组，描述中的 grp= 标记，为空时按服务器IP选择群组
+	OldExpiryDate time.Time // 原到期时间
+	ExpiryDate    time.Time // 新到期时间
+	RenewTime     time.Time // 续期时间
+}
+
+// InvalidTagNotification 过期标记无效的提醒实体
+type InvalidTagNotification struct {
+	Source        string    // 消息来源路由器
+	GlobalAddress string    // 外网地址端口
+	LocalAddress  string    // 内网地址端口
+	Protocol      string    // 协议类型
+	Description   string    // 路由器上的原始描述
+	Reason        string    // 标记无效的原因
+	Owner         string    // 负责人，描述中的 own= 标记
+	Ticket        string    // 工单号，描述中的 tk= 标记
+	Group         string    // 通知群组，描述中的 grp= 标记，为空时按服务器IP选择群组
+	NotifyTime    time.Time // 通知时间
+}
+
 // FormatMessage 格式化通知消息为Markdown格式
 func (n *ExpiryNotification) FormatMessage() string {
 	return fmt.Sprintf(`## [通知] 端口映射即将过期
 
-**消息来源：** H3c-MSR2600
+**消息来源：** %s
 
 **外网地址端口：** %s
 
@@ -39,17 +76,19 @@ func (n *ExpiryNotification) FormatMessage() string {
 
 **描述：** %s
 
-**到期时间：** %s
+%s**到期时间：** %s
 
 **通知时间：** %s
 
 ---
 
 [查看内外网映射关系表](https://alidocs.dingtalk.com/i/nodes/0eMKjyp813EOMaXPH9EkeOZwVxAZB1Gv?utm_scene=team_space)`,
+		n.Source,
 		n.GlobalAddress,
 		n.LocalAddress,
 		n.Protocol,
 		n.Description,
+		ownerLines(n.Owner, n.Ticket),
 		n.ExpiryDate.Format(time.DateTime),
 		n.NotifyTime.Format(time.DateTime),
 	)
@@ -64,7 +103,7 @@ func (n *ExpiryNotification) FormatMessageWithGroup(groupName string) string {
 func (d *DeletionNotification) FormatMessage() string {
 	return fmt.Sprintf(`## [通知] 端口映射条目删除
 
-**消息来源：** H3c-MSR2600
+**消息来源：** %s
 
 **外网地址端口：** %s
 
@@ -74,18 +113,109 @@ func (d *DeletionNotification) FormatMessage() string {
 
 **描述：** %s
 
-**到期时间：** %s
+%s**到期时间：** %s
 
 **删除时间：** %s
 
 ---
 
 [查看内外网映射关系表](https://alidocs.dingtalk.com/i/nodes/0eMKjyp813EOMaXPH9EkeOZwVxAZB1Gv?utm_scene=team_space)`,
+		d.Source,
 		d.GlobalAddress,
 		d.LocalAddress,
 		d.Protocol,
 		d.Description,
+		ownerLines(d.Owner, d.Ticket),
 		d.ExpiryDate.Format(time.DateTime),
 		d.DeleteTime.Format(time.DateTime),
 	)
-}
\ No newline at end of file
+}
+
+// FormatMessage 格式化续期通知消息为Markdown格式
+func (r *RenewalNotification) FormatMessage() string {
+	return fmt.Sprintf(`## [通知] 端口映射已续期
+
+**消息来源：** %s
+
+**外网地址端口：** %s
+
+**内网地址端口：** %s
+
+**协议类型：** %s
+
+**描述：** %s
+
+%s**原到期时间：** %s
+
+**新到期时间：** %s
+
+**续期时间：** %s
+
+---
+
+[查看内外网映射关系表](https://alidocs.dingtalk.com/i/nodes/0eMKjyp813EOMaXPH9EkeOZwVxAZB1Gv?utm_scene=team_space)`,
+		r.Source,
+		r.GlobalAddress,
+		r.LocalAddress,
+		r.Protocol,
+		r.Description,
+		ownerLines(r.Owner, r.Ticket),
+		FormatExpiry(r.OldExpiryDate),
+		r.ExpiryDate.Format(time.DateTime),
+		r.RenewTime.Format(time.DateTime),
+	)
+}
+
+// FormatMessage 格式化标记无效提醒为Markdown格式
+func (i *InvalidTagNotification) FormatMessage() string {
+	return fmt.Sprintf(`## [提醒] 端口映射过期标记无效
+
+**消息来源：** %s
+
+**外网地址端口：** %s
+
+**内网地址端口：** %s
+
+**协议类型：** %s
+
+**描述：** %s
+
+%s**问题：** %s
+
+**通知时间：** %s
+
+该映射不会按过期时间自动提醒和删除，请将描述中的过期标记改为有效的日期（如 vp=260112），或使用续期操作重新写入。
+
+---
+
+[查看内外网映射关系表](https://alidocs.dingtalk.com/i/nodes/0eMKjyp813EOMaXPH9EkeOZwVxAZB1Gv?utm_scene=team_space)`,
+		i.Source,
+		i.GlobalAddress,
+		i.LocalAddress,
+		i.Protocol,
+		i.Description,
+		ownerLines(i.Owner, i.Ticket),
+		i.Reason,
+		i.NotifyTime.Format(time.DateTime),
+	)
+}
+
+// FormatExpiry 格式化到期时间，零值表示原过期标记无效
+func FormatExpiry(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "无效标记"
+	}
+	return expiry.Format(time.DateTime)
+}
+
+// ownerLines 生成负责人和工单号两行，未标记的项不输出
+func ownerLines(owner, ticket string) string {
+	var lines string
+	if owner != "" {
+		lines += fmt.Sprintf("**负责人：** %s\n\n", owner)
+	}
+	if ticket != "" {
+		lines += fmt.Sprintf("**工单号：** %s\n\n", ticket)
+	}
+	return lines
+}
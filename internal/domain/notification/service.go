@@ -1,9 +1,15 @@
 package notification
 
-// Service 通知服务接口
+import "context"
+
+// Service 通知服务接口，ctx取消时正在发送的通知会中断
 type Service interface {
 	// SendNotification 发送过期通知
-	SendNotification(notification *ExpiryNotification) error
+	SendNotification(ctx context.Context, notification *ExpiryNotification) error
 	// SendDeletionNotification 发送删除通知
-	SendDeletionNotification(notification *DeletionNotification) error
-}
\ No newline at end of file
+	SendDeletionNotification(ctx context.Context, notification *DeletionNotification) error
+	// SendRenewalNotification 发送续期通知
+	SendRenewalNotification(ctx context.Context, notification *RenewalNotification) error
+	// SendInvalidTagNotification 发送过期标记无效的提醒
+	SendInvalidTagNotification(ctx context.Context, notification *InvalidTagNotification) error
+}
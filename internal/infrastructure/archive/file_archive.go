@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// FileArchive 基于JSON Lines文件的只追加备份归档
+type FileArchive struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileArchive 创建文件归档
+func NewFileArchive(path string) *FileArchive {
+	return &FileArchive{path: path}
+}
+
+// Append 追加一条备份记录并落盘
+func (a *FileArchive) Append(record *nat.BackupRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化备份记录失败: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
+		return fmt.Errorf("创建备份目录失败: %v", err)
+	}
+
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开备份文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入备份文件失败: %v", err)
+	}
+	// 备份必须在删除前真正写入磁盘
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("同步备份文件失败: %v", err)
+	}
+	return nil
+}
+
+// Records 读取所有备份记录，文件不存在时返回空
+func (a *FileArchive) Records() ([]*nat.BackupRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("打开备份文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var records []*nat.BackupRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record nat.BackupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("解析备份文件第 %d 行失败: %v", line, err)
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取备份文件失败: %v", err)
+	}
+	return records, nil
+}
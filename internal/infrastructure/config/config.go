@@ -6,6 +6,12 @@ import (
 	"io/ioutil"
 	"net"
 	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 内置时区数据，timezone 不依赖运行环境的 /usr/share/zoneinfo
 )
 
 // ExpiryTimeConfig 过期时间配置
@@ -25,38 +31,277 @@ func (e *ExpiryTimeConfig) Validate() error {
 	return nil
 }
 
+// SSH认证方式
+const (
+	AuthPublicKey           = "publickey"
+	AuthAgent               = "agent"
+	AuthPassword            = "password"
+	AuthKeyboardInteractive = "keyboard-interactive"
+)
+
+// SSHAuthConfig SSH认证配置
+type SSHAuthConfig struct {
+	User                string   `yaml:"user"`
+	Passwd              string   `yaml:"passwd"`
+	PrivateKey          string   `yaml:"private_key"`          // 私钥文件路径
+	Passphrase          string   `yaml:"passphrase"`           // 私钥密码，可选
+	AgentSocket         string   `yaml:"agent_socket"`         // SSH agent套接字路径，支持 ${SSH_AUTH_SOCK}
+	KeyboardInteractive bool     `yaml:"keyboard_interactive"` // 使用passwd应答keyboard-interactive认证
+	AuthMethods         []string `yaml:"auth_methods"`         // 认证方式尝试顺序，为空时按 publickey、agent、password、keyboard-interactive
+}
+
+// Methods 返回按顺序尝试的认证方式，只包含已配置的方式
+func (a *SSHAuthConfig) Methods() []string {
+	order := a.AuthMethods
+	if len(order) == 0 {
+		order = []string{AuthPublicKey, AuthAgent, AuthPassword, AuthKeyboardInteractive}
+	}
+
+	var methods []string
+	for _, method := range order {
+		switch method {
+		case AuthPublicKey:
+			if a.PrivateKey == "" {
+				continue
+			}
+		case AuthAgent:
+			if a.AgentSocket == "" {
+				continue
+			}
+		case AuthPassword:
+			if a.Passwd == "" {
+				continue
+			}
+		case AuthKeyboardInteractive:
+			if !a.KeyboardInteractive {
+				continue
+			}
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+// Validate 验证SSH认证配置
+func (a *SSHAuthConfig) Validate() error {
+	if a.User == "" {
+		return fmt.Errorf("用户名不能为空")
+	}
+
+	for _, method := range a.AuthMethods {
+		switch method {
+		case AuthPublicKey, AuthAgent, AuthPassword, AuthKeyboardInteractive:
+		default:
+			return fmt.Errorf("不支持的认证方式: %s", method)
+		}
+	}
+
+	if a.KeyboardInteractive && a.Passwd == "" {
+		return fmt.Errorf("keyboard-interactive认证需要配置密码")
+	}
+
+	if len(a.Methods()) == 0 {
+		return fmt.Errorf("至少需要配置一种认证方式: 密码、私钥或SSH agent")
+	}
+
+	return nil
+}
+
+// defaultSSHPort 默认SSH端口
+const defaultSSHPort = 22
+
+// defaultNetconfPort 默认NETCONF over SSH端口
+const defaultNetconfPort = 830
+
+// 路由器管理方式
+const (
+	BackendCLI     = "cli"
+	BackendNetconf = "netconf"
+)
+
+// 路由器CLI的文本编码
+const (
+	EncodingUTF8 = "utf-8"
+	EncodingGBK  = "gbk"
+)
+
+// hostnamePattern 主机名格式
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9\-.]*[A-Za-z0-9])?$`)
+
+// validateHost 验证主机地址，支持IP和主机名
+func validateHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("主机地址不能为空")
+	}
+	if net.ParseIP(host) == nil && !hostnamePattern.MatchString(host) {
+		return fmt.Errorf("无效的主机地址: %s", host)
+	}
+	return nil
+}
+
+// validatePort 验证端口
+func validatePort(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("端口必须在1-65535之间，当前值: %d", port)
+	}
+	return nil
+}
+
+// validateFingerprint 验证主机密钥指纹格式
+func validateFingerprint(fingerprint string) error {
+	if fingerprint != "" && !strings.HasPrefix(fingerprint, "SHA256:") && !strings.HasPrefix(fingerprint, "MD5:") {
+		return fmt.Errorf("主机密钥指纹必须以 SHA256: 或 MD5: 开头，当前值: %s", fingerprint)
+	}
+	return nil
+}
+
+// address 拼接主机和端口，端口为0时使用22
+func address(host string, port int) string {
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// JumpHostConfig 跳板机配置，类似ssh的ProxyJump
+type JumpHostConfig struct {
+	SSHAuthConfig `yaml:",inline"` // 跳板机自己的认证信息
+
+	Host               string `yaml:"host"`
+	Port               int    `yaml:"port"`                 // 默认22
+	HostKeyFingerprint string `yaml:"host_key_fingerprint"` // 未配置时按路由器的known_hosts校验
+}
+
+// Address 返回跳板机的 host:port
+func (j *JumpHostConfig) Address() string {
+	return address(j.Host, j.Port)
+}
+
+// Validate 验证跳板机配置
+func (j *JumpHostConfig) Validate() error {
+	if err := validateHost(j.Host); err != nil {
+		return err
+	}
+	if err := validatePort(j.Port); err != nil {
+		return err
+	}
+	if err := j.SSHAuthConfig.Validate(); err != nil {
+		return fmt.Errorf("认证配置无效: %v", err)
+	}
+	return validateFingerprint(j.HostKeyFingerprint)
+}
+
 // RouterConfig 路由器配置
 type RouterConfig struct {
-	Host                     string           `yaml:"host"`
-	User                     string           `yaml:"user"`
-	Passwd                   string           `yaml:"passwd"`
+	SSHAuthConfig `yaml:",inline"` // user、passwd及其他认证方式
+
+	Name                     string           `yaml:"name"` // 路由器名称，显示在日志和通知的消息来源中
+	Host                     string           `yaml:"host"` // IP或主机名
+	Port                     int              `yaml:"port"` // SSH端口，默认22
 	ReminderBeforeExpiration int              `yaml:"Reminder_before_expiration"`
 	ExpiryTime               ExpiryTimeConfig `yaml:"expiry_time"`
+	Timezone                 string           `yaml:"timezone"`             // 路由器所在时区，如 Asia/Shanghai，为空时使用系统时区
+	KnownHosts               string           `yaml:"known_hosts"`          // known_hosts文件路径，默认与配置文件同目录
+	HostKeyFingerprint       string           `yaml:"host_key_fingerprint"` // 固定的主机密钥指纹，如 SHA256:xxxx，配置后优先于known_hosts
+	JumpHosts                []JumpHostConfig `yaml:"jump_hosts"`           // 跳板机链，按顺序逐跳连接
+	SaveAfterChanges         bool             `yaml:"save_after_changes"`   // 有修改的运行结束后执行 save force，一次运行只保存一次
+	Backend                  string           `yaml:"backend"`              // 管理方式: cli(默认) 或 netconf
+	NetconfPort              int              `yaml:"netconf_port"`         // NETCONF over SSH端口，默认830
+	Encoding                 string           `yaml:"encoding"`             // CLI的文本编码: gbk 或 utf-8，为空时按输出自动识别
+
+	location *time.Location // Validate 解析出的时区
+}
+
+// Address 返回路由器的 host:port
+func (r *RouterConfig) Address() string {
+	return address(r.Host, r.Port)
+}
+
+// NetconfAddress 返回路由器NETCONF服务的 host:port
+func (r *RouterConfig) NetconfAddress() string {
+	port := r.NetconfPort
+	if port == 0 {
+		port = defaultNetconfPort
+	}
+	return address(r.Host, port)
+}
+
+// Location 返回路由器所在时区，用于解析和比较过期时间、格式化通知中的时间。
+// 返回 Validate 解析出的时区，未配置时为系统时区；未经 Validate 的配置按 Timezone 现场解析
+func (r *RouterConfig) Location() *time.Location {
+	if r.location != nil {
+		return r.location
+	}
+	loc, err := loadLocation(r.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// loadLocation 解析时区名称，为空时返回系统时区
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区 timezone: %s", name)
+	}
+	return loc, nil
 }
 
 // Validate 验证路由器配置
 func (r *RouterConfig) Validate() error {
-	if r.Host == "" {
-		return fmt.Errorf("路由器主机地址不能为空")
+	if err := validateHost(r.Host); err != nil {
+		return fmt.Errorf("路由器%v", err)
 	}
-	
-	// 验证IP地址格式
-	if net.ParseIP(r.Host) == nil {
-		return fmt.Errorf("无效的IP地址格式: %s", r.Host)
+
+	if err := validatePort(r.Port); err != nil {
+		return fmt.Errorf("路由器%v", err)
 	}
-	
-	if r.User == "" {
-		return fmt.Errorf("路由器用户名不能为空")
+
+	switch r.Backend {
+	case "", BackendCLI:
+	case BackendNetconf:
+		if err := validatePort(r.NetconfPort); err != nil {
+			return fmt.Errorf("路由器NETCONF%v", err)
+		}
+	default:
+		return fmt.Errorf("无效的管理方式 backend: %s，可选 cli 或 netconf", r.Backend)
+	}
+
+	switch r.Encoding {
+	case "", EncodingUTF8, EncodingGBK:
+	default:
+		return fmt.Errorf("无效的编码 encoding: %s，可选 gbk 或 utf-8", r.Encoding)
+	}
+
+	if err := r.SSHAuthConfig.Validate(); err != nil {
+		return fmt.Errorf("路由器认证配置无效: %v", err)
+	}
+
+	if err := validateFingerprint(r.HostKeyFingerprint); err != nil {
+		return err
 	}
-	
-	if r.Passwd == "" {
-		return fmt.Errorf("路由器密码不能为空")
+
+	for i := range r.JumpHosts {
+		if err := r.JumpHosts[i].Validate(); err != nil {
+			return fmt.Errorf("第 %d 个跳板机配置无效: %v", i+1, err)
+		}
 	}
-	
+
 	if r.ReminderBeforeExpiration <= 0 {
 		return fmt.Errorf("提醒天数必须大于0，当前值: %d", r.ReminderBeforeExpiration)
 	}
-	
+
+	// 时区只解析一次，无效的时区使配置加载失败，而不是按系统时区计算过期时间
+	loc, err := loadLocation(r.Timezone)
+	if err != nil {
+		return err
+	}
+	r.location = loc
+
 	return r.ExpiryTime.Validate()
 }
 
@@ -73,27 +318,27 @@ func (d *DingTalkGroupConfig) Validate() error {
 	if d.Webhook == "" {
 		return fmt.Errorf("钉钉Webhook不能为空")
 	}
-	
+
 	// 验证Webhook URL格式
 	if _, err := url.Parse(d.Webhook); err != nil {
 		return fmt.Errorf("无效的Webhook URL格式: %s", d.Webhook)
 	}
-	
+
 	if d.Secret == "" {
 		return fmt.Errorf("钉钉Secret不能为空")
 	}
-	
+
 	if d.Name == "" {
 		return fmt.Errorf("钉钉群组名称不能为空")
 	}
-	
+
 	// 验证服务器IP地址
 	for _, server := range d.Servers {
 		if net.ParseIP(server) == nil {
 			return fmt.Errorf("无效的服务器IP地址: %s", server)
 		}
 	}
-	
+
 	return nil
 }
 
@@ -108,32 +353,157 @@ func (d *DingTalkConfig) Validate() error {
 	if err := d.Default.Validate(); err != nil {
 		return fmt.Errorf("默认钉钉配置验证失败: %v", err)
 	}
-	
+
 	for groupName, groupConfig := range d.Groups {
 		if err := groupConfig.Validate(); err != nil {
 			return fmt.Errorf("钉钉群组 '%s' 配置验证失败: %v", groupName, err)
 		}
 	}
-	
+
 	return nil
 }
 
+// BackupConfig 删除前备份配置
+type BackupConfig struct {
+	Archive string `yaml:"archive"` // 备份归档文件路径，默认与配置文件同目录的 nat_backup.jsonl
+}
+
+// 运行时配置默认值
+const (
+	defaultDeadline          = 10 * time.Minute
+	defaultConnectTimeout    = 30 * time.Second
+	defaultCommandTimeout    = 30 * time.Second
+	defaultNotifyTimeout     = 10 * time.Second
+	defaultWorkers           = 5
+	defaultRouterConcurrency = 2
+	defaultNotifyConcurrency = 5
+)
+
+// RuntimeConfig 运行时限和并发配置，未配置或为0的项使用默认值
+type RuntimeConfig struct {
+	Deadline          time.Duration `yaml:"deadline"`           // 整次运行的时限，默认10m
+	ConnectTimeout    time.Duration `yaml:"connect_timeout"`    // SSH建立连接（含握手）的超时，默认30s
+	CommandTimeout    time.Duration `yaml:"command_timeout"`    // 单条命令或NETCONF请求等待应答的超时，默认30s
+	NotifyTimeout     time.Duration `yaml:"notify_timeout"`     // 单条通知发送的超时，默认10s
+	Workers           int           `yaml:"workers"`            // 每个路由器同时处理的条目数，默认5
+	RouterConcurrency int           `yaml:"router_concurrency"` // 每个路由器同时进行的修改数，也是同时打开的SSH会话数，默认2
+	NotifyConcurrency int           `yaml:"notify_concurrency"` // 同时发送的通知数，默认5
+}
+
+// ApplyDefaults 为未配置的项填入默认值
+func (r *RuntimeConfig) ApplyDefaults() {
+	if r.Deadline == 0 {
+		r.Deadline = defaultDeadline
+	}
+	if r.ConnectTimeout == 0 {
+		r.ConnectTimeout = defaultConnectTimeout
+	}
+	if r.CommandTimeout == 0 {
+		r.CommandTimeout = defaultCommandTimeout
+	}
+	if r.NotifyTimeout == 0 {
+		r.NotifyTimeout = defaultNotifyTimeout
+	}
+	if r.Workers == 0 {
+		r.Workers = defaultWorkers
+	}
+	if r.RouterConcurrency == 0 {
+		r.RouterConcurrency = defaultRouterConcurrency
+	}
+	if r.NotifyConcurrency == 0 {
+		r.NotifyConcurrency = defaultNotifyConcurrency
+	}
+}
+
+// Validate 验证运行时配置
+func (r *RuntimeConfig) Validate() error {
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"deadline", r.Deadline},
+		{"connect_timeout", r.ConnectTimeout},
+		{"command_timeout", r.CommandTimeout},
+		{"notify_timeout", r.NotifyTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			return fmt.Errorf("%s 不能为负数: %v", d.name, d.value)
+		}
+	}
+
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"workers", r.Workers},
+		{"router_concurrency", r.RouterConcurrency},
+		{"notify_concurrency", r.NotifyConcurrency},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			return fmt.Errorf("%s 不能为负数: %d", l.name, l.value)
+		}
+	}
+
+	if r.CommandTimeout > r.Deadline {
+		return fmt.Errorf("command_timeout(%v) 不能大于 deadline(%v)", r.CommandTimeout, r.Deadline)
+	}
+	return nil
+}
+
+// legacyRouterName 旧版单路由器配置使用的名称
+const legacyRouterName = "H3c-MSR2600"
+
 // Config 应用配置
 type Config struct {
-	Router   RouterConfig   `yaml:"h3c-msr2600"`
+	Router   RouterConfig   `yaml:"h3c-msr2600"` // 旧版单路由器配置，加载时并入Routers
+	Routers  []RouterConfig `yaml:"routers"`
 	DingTalk DingTalkConfig `yaml:"dingtalk"`
+	Backup   BackupConfig   `yaml:"backup"`
+	Runtime  RuntimeConfig  `yaml:"runtime"`
+}
+
+// normalizeRouters 将旧版 h3c-msr2600 配置并入路由器列表
+func (c *Config) normalizeRouters() {
+	if len(c.Routers) == 0 && c.Router.Host != "" {
+		c.Routers = []RouterConfig{c.Router}
+	}
+	if len(c.Routers) == 1 && c.Routers[0].Name == "" {
+		c.Routers[0].Name = legacyRouterName
+	}
 }
 
 // Validate 验证整个配置
 func (c *Config) Validate() error {
-	if err := c.Router.Validate(); err != nil {
-		return fmt.Errorf("路由器配置验证失败: %v", err)
+	if len(c.Routers) == 0 {
+		return fmt.Errorf("至少需要配置一个路由器")
 	}
-	
+
+	names := make(map[string]bool)
+	for i := range c.Routers {
+		router := &c.Routers[i]
+		if router.Name == "" {
+			return fmt.Errorf("第 %d 个路由器缺少名称", i+1)
+		}
+		if names[router.Name] {
+			return fmt.Errorf("路由器名称重复: %s", router.Name)
+		}
+		names[router.Name] = true
+
+		if err := router.Validate(); err != nil {
+			return fmt.Errorf("路由器 '%s' 配置验证失败: %v", router.Name, err)
+		}
+	}
+
 	if err := c.DingTalk.Validate(); err != nil {
 		return fmt.Errorf("钉钉配置验证失败: %v", err)
 	}
-	
+
+	if err := c.Runtime.Validate(); err != nil {
+		return fmt.Errorf("运行时配置验证失败: %v", err)
+	}
+
 	return nil
 }
 
@@ -150,10 +520,23 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("解析配置文件失败: %v", err)
 	}
 
+	config.normalizeRouters()
+	config.Runtime.ApplyDefaults()
+
 	// 验证配置
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("配置验证失败: %v", err)
 	}
 
+	// 未指定known_hosts和备份文件时放在配置文件同目录，便于容器挂载
+	for i := range config.Routers {
+		if config.Routers[i].KnownHosts == "" {
+			config.Routers[i].KnownHosts = filepath.Join(filepath.Dir(filename), "known_hosts")
+		}
+	}
+	if config.Backup.Archive == "" {
+		config.Backup.Archive = filepath.Join(filepath.Dir(filename), "nat_backup.jsonl")
+	}
+
 	return &config, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validRouter 返回一份有效的路由器配置
+func validRouter() RouterConfig {
+	return RouterConfig{
+		SSHAuthConfig:            SSHAuthConfig{User: "admin", Passwd: "secret"},
+		Name:                     "core",
+		Host:                     "192.168.1.1",
+		ReminderBeforeExpiration: 10,
+		ExpiryTime:               ExpiryTimeConfig{Hour: 21, Minute: 30},
+	}
+}
+
+func TestRouterConfigValidateHost(t *testing.T) {
+	tests := []struct {
+		host  string
+		port  int
+		valid bool
+	}{
+		{"192.168.1.1", 0, true},
+		{"fd00::1", 22, true},
+		{"router", 0, true},
+		{"edge-01.corp.example.com", 2222, true},
+		{"router.example.com", 65535, true},
+		{"", 0, false},
+		{"-router", 0, false},
+		{"router_01", 0, false},
+		{"router.example.com.", 0, false},
+		// 端口单独配置，host 中不能带端口
+		{"router.example.com:2222", 0, false},
+		{"192.168.1.1:22", 0, false},
+		{"router.example.com", -1, false},
+		{"router.example.com", 65536, false},
+	}
+
+	for _, tt := range tests {
+		r := validRouter()
+		r.Host = tt.host
+		r.Port = tt.port
+		if err := r.Validate(); (err == nil) != tt.valid {
+			t.Errorf("host=%q port=%d: Validate() = %v, 期望有效: %v", tt.host, tt.port, err, tt.valid)
+		}
+	}
+}
+
+func TestRouterConfigAddress(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"router.example.com", 0, "router.example.com:22"},
+		{"router.example.com", 2222, "router.example.com:2222"},
+		{"fd00::1", 0, "[fd00::1]:22"},
+	}
+
+	for _, tt := range tests {
+		r := RouterConfig{Host: tt.host, Port: tt.port}
+		if got := r.Address(); got != tt.want {
+			t.Errorf("Address() = %q, 期望 %q", got, tt.want)
+		}
+	}
+}
+
+func TestRouterConfigValidateJumpHosts(t *testing.T) {
+	r := validRouter()
+	r.JumpHosts = []JumpHostConfig{
+		{SSHAuthConfig: SSHAuthConfig{User: "ops", Passwd: "secret"}, Host: "bastion.example.com"},
+		{SSHAuthConfig: SSHAuthConfig{User: "ops", Passwd: "secret"}, Host: "10.0.0.1", Port: 2222, HostKeyFingerprint: "SHA256:abc"},
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if got := r.JumpHosts[0].Address(); got != "bastion.example.com:22" {
+		t.Errorf("跳板机 Address() = %q", got)
+	}
+
+	invalid := []JumpHostConfig{
+		{SSHAuthConfig: SSHAuthConfig{User: "ops", Passwd: "secret"}, Host: "bastion:22"},
+		{SSHAuthConfig: SSHAuthConfig{User: "ops", Passwd: "secret"}, Host: "bastion", Port: 70000},
+		{SSHAuthConfig: SSHAuthConfig{User: "ops"}, Host: "bastion"},
+		{SSHAuthConfig: SSHAuthConfig{User: "ops", Passwd: "secret"}, Host: "bastion", HostKeyFingerprint: "abc"},
+	}
+	for _, jump := range invalid {
+		r := validRouter()
+		r.JumpHosts = []JumpHostConfig{jump}
+		if err := r.Validate(); err == nil {
+			t.Errorf("跳板机 %+v: Validate() 应返回错误", jump)
+		}
+	}
+}
+
+func TestRouterConfigLocation(t *testing.T) {
+	r := validRouter()
+	r.Timezone = "Asia/Shanghai"
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Location().String(); got != "Asia/Shanghai" {
+		t.Errorf("Location() = %s, 期望 Asia/Shanghai", got)
+	}
+	// 时区在 Validate 时解析一次，之后复用同一个 *time.Location
+	if r.Location() != r.Location() {
+		t.Error("Location() 每次调用都重新解析时区")
+	}
+
+	r = validRouter()
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Location() != time.Local {
+		t.Errorf("未配置时区时 Location() = %s, 期望系统时区", r.Location())
+	}
+
+	r = validRouter()
+	r.Timezone = "Asia/Shanghia"
+	if err := r.Validate(); err == nil || !strings.Contains(err.Error(), "Asia/Shanghia") {
+		t.Errorf("无效的时区 Validate() = %v, 期望返回错误", err)
+	}
+}
+
+func TestLoadConfigRejectsUnknownTimezone(t *testing.T) {
+	data, err := os.ReadFile("../../../configs/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(timezone string) string {
+		t.Helper()
+		filename := filepath.Join(dir, "config.yaml")
+		content := strings.Replace(string(data), "timezone: Asia/Shanghai ", "timezone: "+timezone+" ", 1)
+		if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	config, err := LoadConfig(write("Asia/Shanghai"))
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+	if got := config.Routers[0].Location().String(); got != "Asia/Shanghai" {
+		t.Errorf("加载后 Location() = %s, 期望 Asia/Shanghai", got)
+	}
+
+	// 拼错的时区使配置加载失败，而不是按系统时区计算过期时间
+	if _, err := LoadConfig(write("Asia/Shanghia")); err == nil || !strings.Contains(err.Error(), "无效的时区") {
+		t.Errorf("LoadConfig() = %v, 期望无效时区错误", err)
+	}
+}
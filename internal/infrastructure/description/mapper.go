@@ -7,14 +7,15 @@ import (
 
 // DescriptionConfig 描述配置结构
 type DescriptionConfig struct {
-	Mappings           map[string]string `yaml:"mappings"`
-	Notes              []string          `yaml:"notes"`
-	DefaultExpiryDays  int               `yaml:"default_expiry_days"`
+	Mappings          map[string]string `yaml:"mappings"`
+	Notes             []string          `yaml:"notes"`
+	DefaultExpiryDays int               `yaml:"default_expiry_days"`
 }
 
 // Mapper 描述映射器
 type Mapper struct {
-	mappings map[string]string
+	mappings          map[string]string
+	defaultExpiryDays int
 }
 
 // NewMapper 创建描述映射器
@@ -38,15 +39,25 @@ func (m *Mapper) LoadMappings(filename string) error {
 	}
 
 	m.mappings = config.Mappings
+	m.defaultExpiryDays = config.DefaultExpiryDays
 	return nil
 }
 
-// GetDescription 获取描述信息
-func (m *Mapper) GetDescription(globalAddress string) string {
+// DefaultExpiryDays 新建映射未指定过期日期时的默认有效天数，未配置时为0
+func (m *Mapper) DefaultExpiryDays() int {
+	return m.defaultExpiryDays
+}
+
+// GetDescription 获取描述信息，映射表优先，其次使用路由器上解码后的描述
+func (m *Mapper) GetDescription(globalAddress, routerDescription string) string {
 	if desc, exists := m.mappings[globalAddress]; exists {
 		return desc
 	}
-	
+
+	if routerDescription != "" {
+		return routerDescription
+	}
+
 	// 如果没有找到映射，返回默认描述
 	return "未知服务-" + globalAddress
-}
\ No newline at end of file
+}
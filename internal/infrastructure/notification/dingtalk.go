@@ -1,71 +1,195 @@
 package notification
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
 	"h3c-nat-manager/internal/domain/notification"
 	"h3c-nat-manager/internal/infrastructure/config"
-	"github.com/youxihu/dingtalk/dingtalk"
 )
 
+// defaultSendTimeout 单次webhook请求的超时时间
+const defaultSendTimeout = 10 * time.Second
+
 // DingTalkService 钉钉通知服务
 type DingTalkService struct {
 	config *config.DingTalkConfig
+	client *http.Client
+}
+
+// dingTalkMessage 钉钉markdown消息
+type dingTalkMessage struct {
+	MsgType  string `json:"msgtype"`
+	Markdown struct {
+		Title string `json:"title"`
+		Text  string `json:"text"`
+	} `json:"markdown"`
+	At struct {
+		AtMobiles []string `json:"atMobiles"`
+		IsAtAll   bool     `json:"isAtAll"`
+	} `json:"at"`
+}
+
+// dingTalkResponse 钉钉webhook应答，errcode非0表示发送失败
+type dingTalkResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
 }
 
 // NewDingTalkService 创建钉钉通知服务
 func NewDingTalkService(dingTalkConfig *config.DingTalkConfig) *DingTalkService {
 	return &DingTalkService{
 		config: dingTalkConfig,
+		client: &http.Client{Timeout: defaultSendTimeout},
+	}
+}
+
+// SetTimeout 设置单次webhook请求的超时时间，为0时使用默认值
+func (d *DingTalkService) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
 	}
+	d.client.Timeout = timeout
 }
 
 // SendNotification 发送过期通知
-func (d *DingTalkService) SendNotification(notify *notification.ExpiryNotification) error {
+func (d *DingTalkService) SendNotification(ctx context.Context, notify *notification.ExpiryNotification) error {
 	// 根据本地IP地址确定服务器IP
 	serverIP := d.extractServerIP(notify.LocalAddress)
-	
+
 	// 选择对应的钉钉群组配置
-	groupConfig := d.selectGroupConfig(serverIP)
-	
+	groupConfig := d.selectGroupConfig(notify.Group, serverIP)
+
 	title := "[通知] 端口映射即将过期"
 	message := notify.FormatMessage()
-	
-	log.Printf("发送过期通知 - 群组: %s, 服务器: %s, 外网地址: %s", 
-		groupConfig.Name, serverIP, notify.GlobalAddress)
-	
-	return dingtalk.SendDingDingNotification(
-		groupConfig.Webhook,
-		groupConfig.Secret,
-		title,
-		message,
-		nil,   // atMobiles
-		false, // isAtAll
-	)
+
+	log.Printf("发送过期通知 - 路由器: %s, 群组: %s, 服务器: %s, 外网地址: %s",
+		notify.Source, groupConfig.Name, serverIP, notify.GlobalAddress)
+
+	return d.send(ctx, groupConfig, title, message)
 }
 
 // SendDeletionNotification 发送删除通知
-func (d *DingTalkService) SendDeletionNotification(notify *notification.DeletionNotification) error {
+func (d *DingTalkService) SendDeletionNotification(ctx context.Context, notify *notification.DeletionNotification) error {
 	// 根据本地IP地址确定服务器IP
 	serverIP := d.extractServerIP(notify.LocalAddress)
-	
+
 	// 选择对应的钉钉群组配置
-	groupConfig := d.selectGroupConfig(serverIP)
-	
+	groupConfig := d.selectGroupConfig(notify.Group, serverIP)
+
 	title := "[通知] 端口映射条目删除"
 	message := notify.FormatMessage()
-	
-	log.Printf("发送删除通知 - 群组: %s, 服务器: %s, 外网地址: %s", 
-		groupConfig.Name, serverIP, notify.GlobalAddress)
-	
-	return dingtalk.SendDingDingNotification(
-		groupConfig.Webhook,
-		groupConfig.Secret,
-		title,
-		message,
-		nil,   // atMobiles
-		false, // isAtAll
-	)
+
+	log.Printf("发送删除通知 - 路由器: %s, 群组: %s, 服务器: %s, 外网地址: %s",
+		notify.Source, groupConfig.Name, serverIP, notify.GlobalAddress)
+
+	return d.send(ctx, groupConfig, title, message)
+}
+
+// SendRenewalNotification 发送续期通知
+func (d *DingTalkService) SendRenewalNotification(ctx context.Context, notify *notification.RenewalNotification) error {
+	// 根据本地IP地址确定服务器IP
+	serverIP := d.extractServerIP(notify.LocalAddress)
+
+	// 选择对应的钉钉群组配置
+	groupConfig := d.selectGroupConfig(notify.Group, serverIP)
+
+	title := "[通知] 端口映射已续期"
+	message := notify.FormatMessage()
+
+	log.Printf("发送续期通知 - 路由器: %s, 群组: %s, 服务器: %s, 外网地址: %s",
+		notify.Source, groupConfig.Name, serverIP, notify.GlobalAddress)
+
+	return d.send(ctx, groupConfig, title, message)
+}
+
+// SendInvalidTagNotification 发送过期标记无效的提醒
+func (d *DingTalkService) SendInvalidTagNotification(ctx context.Context, notify *notification.InvalidTagNotification) error {
+	// 根据本地IP地址确定服务器IP
+	serverIP := d.extractServerIP(notify.LocalAddress)
+
+	// 选择对应的钉钉群组配置
+	groupConfig := d.selectGroupConfig(notify.Group, serverIP)
+
+	title := "[提醒] 端口映射过期标记无效"
+	message := notify.FormatMessage()
+
+	log.Printf("发送标记无效提醒 - 路由器: %s, 群组: %s, 服务器: %s, 外网地址: %s",
+		notify.Source, groupConfig.Name, serverIP, notify.GlobalAddress)
+
+	return d.send(ctx, groupConfig, title, message)
+}
+
+// send 向群组webhook发送markdown消息，配置了secret时按钉钉规则加签，ctx取消时中断请求
+func (d *DingTalkService) send(ctx context.Context, group config.DingTalkGroupConfig, title, text string) error {
+	message := dingTalkMessage{MsgType: "markdown"}
+	message.Markdown.Title = title
+	message.Markdown.Text = text
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("序列化钉钉消息失败: %v", err)
+	}
+
+	webhook, err := url.Parse(group.Webhook)
+	if err != nil {
+		return fmt.Errorf("无效的webhook地址: %v", err)
+	}
+	if group.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		query := webhook.Query()
+		query.Set("timestamp", timestamp)
+		query.Set("sign", sign(timestamp, group.Secret))
+		webhook.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.String(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("创建钉钉请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送钉钉请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取钉钉应答失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("钉钉应答状态码 %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result dingTalkResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("解析钉钉应答失败: %v", err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("钉钉返回错误 %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// sign 钉钉加签：以secret为密钥对 "timestamp\nsecret" 做HMAC-SHA256后Base64编码
+func sign(timestamp, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
 // extractServerIP 从本地地址中提取服务器IP
@@ -83,8 +207,16 @@ func (d *DingTalkService) extractServerIP(localAddress string) string {
 	return localAddress
 }
 
-// selectGroupConfig 根据服务器IP选择对应的群组配置
-func (d *DingTalkService) selectGroupConfig(serverIP string) config.DingTalkGroupConfig {
+// selectGroupConfig 选择通知群组：描述中有 grp= 标记且配置了该群组时使用该群组，否则根据服务器IP选择
+func (d *DingTalkService) selectGroupConfig(group, serverIP string) config.DingTalkGroupConfig {
+	if group != "" {
+		if groupConfig, ok := d.config.Groups[group]; ok {
+			log.Printf("按描述中的群组标记选择群组 - 服务器: %s, 群组: %s", serverIP, group)
+			return groupConfig
+		}
+		log.Printf("描述中的群组 %s 未配置，按服务器IP选择群组 - 服务器: %s", group, serverIP)
+	}
+
 	// 遍历所有群组，查找包含该服务器IP的群组
 	for groupName, groupConfig := range d.config.Groups {
 		for _, ip := range groupConfig.Servers {
@@ -94,8 +226,8 @@ func (d *DingTalkService) selectGroupConfig(serverIP string) config.DingTalkGrou
 			}
 		}
 	}
-	
+
 	// 如果没有找到匹配的群组，使用默认配置
 	log.Printf("服务器未找到匹配群组，使用默认群组 - 服务器: %s", serverIP)
 	return d.config.Default
-}
\ No newline at end of file
+}
@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/notification"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+func TestDingTalkSendSigned(t *testing.T) {
+	var got dingTalkMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("access_token") != "token" {
+			t.Errorf("access_token = %q, 期望保留webhook原有参数", query.Get("access_token"))
+		}
+		if want := sign(query.Get("timestamp"), "SECtest"); query.Get("sign") != want {
+			t.Errorf("sign = %q, 期望 %q", query.Get("sign"), want)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("解析消息失败: %v", err)
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	svc := NewDingTalkService(&config.DingTalkConfig{
+		Default: config.DingTalkGroupConfig{Name: "默认", Webhook: server.URL + "/robot/send?access_token=token", Secret: "SECtest"},
+	})
+	err := svc.SendDeletionNotification(context.Background(), &notification.DeletionNotification{
+		Source:        "sim",
+		GlobalAddress: "117.149.14.2:7935",
+		LocalAddress:  "192.168.1.112:7935",
+	})
+	if err != nil {
+		t.Fatalf("SendDeletionNotification() = %v", err)
+	}
+	if got.MsgType != "markdown" || got.Markdown.Title != "[通知] 端口映射条目删除" {
+		t.Errorf("消息 = %+v", got)
+	}
+}
+
+func TestDingTalkSendErrors(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	svc := NewDingTalkService(&config.DingTalkConfig{})
+	group := config.DingTalkGroupConfig{Webhook: server.URL + "/robot/send", Secret: "SECtest"}
+	if err := svc.send(context.Background(), group, "title", "text"); err == nil {
+		t.Error("errcode非0时应返回错误")
+	}
+
+	// 取消上下文应中断正在等待应答的请求
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	group.Webhook = server.URL + "/robot/send?slow=1"
+	if err := svc.send(ctx, group, "title", "text"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("send() = %v, 期望 context.DeadlineExceeded", err)
+	}
+}
+
+func TestDingTalkSelectGroupByTag(t *testing.T) {
+	svc := NewDingTalkService(&config.DingTalkConfig{
+		Default: config.DingTalkGroupConfig{Name: "默认"},
+		Groups: map[string]config.DingTalkGroupConfig{
+			"inspection": {Name: "巡检项目组", Servers: []string{"192.168.1.112"}},
+			"dongwu":     {Name: "东吴项目组"},
+		},
+	})
+
+	tests := []struct {
+		group, serverIP, want string
+	}{
+		{"dongwu", "192.168.1.112", "东吴项目组"},  // grp= 优先于服务器IP
+		{"unknown", "192.168.1.112", "巡检项目组"}, // 未配置的群组按服务器IP选择
+		{"", "10.0.0.1", "默认"},
+	}
+	for _, tt := range tests {
+		if got := svc.selectGroupConfig(tt.group, tt.serverIP).Name; got != tt.want {
+			t.Errorf("selectGroupConfig(%q, %q) = %s, 期望 %s", tt.group, tt.serverIP, got, tt.want)
+		}
+	}
+}
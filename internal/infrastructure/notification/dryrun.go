@@ -0,0 +1,55 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+
+	"h3c-nat-manager/internal/domain/notification"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+// DryRunService 演练模式的通知服务，按钉钉的分组规则选择群组，只打印通知内容不发送
+type DryRunService struct {
+	dingTalk *DingTalkService
+}
+
+// NewDryRunService 创建演练通知服务
+func NewDryRunService(dingTalkConfig *config.DingTalkConfig) *DryRunService {
+	return &DryRunService{
+		dingTalk: NewDingTalkService(dingTalkConfig),
+	}
+}
+
+// SendNotification 打印过期通知
+func (d *DryRunService) SendNotification(ctx context.Context, notify *notification.ExpiryNotification) error {
+	d.print("[通知] 端口映射即将过期", notify.Group, notify.LocalAddress, notify.FormatMessage())
+	return nil
+}
+
+// SendDeletionNotification 打印删除通知
+func (d *DryRunService) SendDeletionNotification(ctx context.Context, notify *notification.DeletionNotification) error {
+	d.print("[通知] 端口映射条目删除", notify.Group, notify.LocalAddress, notify.FormatMessage())
+	return nil
+}
+
+// SendRenewalNotification 打印续期通知
+func (d *DryRunService) SendRenewalNotification(ctx context.Context, notify *notification.RenewalNotification) error {
+	d.print("[通知] 端口映射已续期", notify.Group, notify.LocalAddress, notify.FormatMessage())
+	return nil
+}
+
+// SendInvalidTagNotification 打印过期标记无效的提醒
+func (d *DryRunService) SendInvalidTagNotification(ctx context.Context, notify *notification.InvalidTagNotification) error {
+	d.print("[提醒] 端口映射过期标记无效", notify.Group, notify.LocalAddress, notify.FormatMessage())
+	return nil
+}
+
+// print 打印通知的目标群组和内容
+func (d *DryRunService) print(title, group, localAddress, message string) {
+	serverIP := d.dingTalk.extractServerIP(localAddress)
+	groupConfig := d.dingTalk.selectGroupConfig(group, serverIP)
+
+	fmt.Printf("[dry-run] 将发送钉钉通知（未发送）: %s\n", title)
+	fmt.Printf("[dry-run]   群组: %s, 服务器: %s\n", groupConfig.Name, serverIP)
+	fmt.Println(message)
+}
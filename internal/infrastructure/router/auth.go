@@ -0,0 +1,123 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+// authMethods 按配置顺序构建SSH认证方式，返回的closer用于关闭agent连接。
+// 私钥和agent都属于publickey认证，而SSH客户端对同名的认证方式只尝试一次，
+// 因此合并为一个认证方式，按配置顺序依次提供私钥和agent中的密钥，私钥被拒绝时仍会尝试agent
+func authMethods(auth *config.SSHAuthConfig) ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	var closers []func()
+	var signers []func() ([]ssh.Signer, error) // 按顺序提供密钥的来源
+	publicKeyIndex := -1                       // 合并后的publickey认证在methods中的位置
+	addSigners := func(source func() ([]ssh.Signer, error)) {
+		if publicKeyIndex < 0 {
+			publicKeyIndex = len(methods)
+			methods = append(methods, nil)
+		}
+		signers = append(signers, source)
+	}
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	for _, name := range auth.Methods() {
+		switch name {
+		case config.AuthPublicKey:
+			signer, err := loadPrivateKey(auth.PrivateKey, auth.Passphrase)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			addSigners(func() ([]ssh.Signer, error) { return []ssh.Signer{signer}, nil })
+
+		case config.AuthAgent:
+			socket := os.ExpandEnv(auth.AgentSocket)
+			conn, err := net.Dial("unix", socket)
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("连接SSH agent失败 %s: %v", socket, err)
+			}
+			closers = append(closers, func() { conn.Close() })
+			addSigners(agent.NewClient(conn).Signers)
+
+		case config.AuthPassword:
+			methods = append(methods, ssh.Password(auth.Passwd))
+
+		case config.AuthKeyboardInteractive:
+			methods = append(methods, ssh.KeyboardInteractive(passwordChallenge(auth.Passwd)))
+		}
+	}
+
+	if publicKeyIndex >= 0 {
+		methods[publicKeyIndex] = ssh.PublicKeysCallback(chainSigners(signers))
+	}
+	return methods, closeAll, nil
+}
+
+// chainSigners 依次收集各来源的密钥，某个来源失败时跳过，全部失败时返回第一个错误
+func chainSigners(sources []func() ([]ssh.Signer, error)) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		var all []ssh.Signer
+		var firstErr error
+		for _, source := range sources {
+			signers, err := source()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("读取SSH agent密钥失败: %v", err)
+				}
+				continue
+			}
+			all = append(all, signers...)
+		}
+		if len(all) == 0 && firstErr != nil {
+			return nil, firstErr
+		}
+		return all, nil
+	}
+}
+
+// loadPrivateKey 读取私钥文件，有密码时解密
+func loadPrivateKey(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥文件失败: %v", err)
+	}
+
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败 %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+// passwordChallenge 用密码应答keyboard-interactive的提问，Comware AAA通常只问一次密码
+func passwordChallenge(password string) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			// 回显的问题一般不是密码，无法自动应答
+			if echos[i] && !strings.Contains(strings.ToLower(question), "password") {
+				return nil, fmt.Errorf("无法自动应答认证提问: %s", question)
+			}
+			answers[i] = password
+		}
+		return answers, nil
+	}
+}
@@ -0,0 +1,117 @@
+package router
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"h3c-nat-manager/internal/infrastructure/config"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+// newTestKey 生成ed25519密钥，返回私钥和对应的SSH签名器
+func newTestKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, signer
+}
+
+// serveAgent 在临时unix套接字上提供只包含key的SSH agent，返回套接字路径
+func serveAgent(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return socket
+}
+
+func TestAuthFallsBackToAgentWhenKeyRejected(t *testing.T) {
+	fileKey, _ := newTestKey(t)
+	agentKey, agentSigner := newTestKey(t)
+
+	// 模拟器只授权agent中的密钥，私钥文件中的密钥会被拒绝
+	sim, err := simulator.New(simulator.Options{User: "admin", AuthorizedKeys: []ssh.PublicKey{agentSigner.PublicKey()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	block, err := ssh.MarshalPrivateKey(fileKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	socket := serveAgent(t, agentKey)
+
+	policy := &HostKeyPolicy{Fingerprint: sim.Fingerprint()}
+	callback, err := policy.Callback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range [][]string{
+		{config.AuthPublicKey, config.AuthAgent},
+		{config.AuthAgent, config.AuthPublicKey},
+	} {
+		methods, closeAuth, err := authMethods(&config.SSHAuthConfig{
+			User:        "admin",
+			PrivateKey:  keyFile,
+			AgentSocket: socket,
+			AuthMethods: order,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client, err := ssh.Dial("tcp", sim.Addr(), &ssh.ClientConfig{
+			User:            "admin",
+			Auth:            methods,
+			HostKeyCallback: callback,
+			Timeout:         5 * time.Second,
+		})
+		closeAuth()
+		if err != nil {
+			t.Errorf("认证顺序 %v: 私钥被拒绝后没有使用agent中的密钥登录: %v", order, err)
+			continue
+		}
+		client.Close()
+	}
+}
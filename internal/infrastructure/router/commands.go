@@ -0,0 +1,146 @@
+package router
+
+import (
+	"strconv"
+	"strings"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// deleteCommands 构建删除条目所需的命令序列，最后退回用户视图
+func deleteCommands(entry *nat.NATEntry) []string {
+	return []string{
+		"system-view",
+		"interface " + entry.Interface,
+		"undo nat server " + globalClause(entry),
+		"return",
+	}
+}
+
+// renewCommands 构建续期所需的命令序列：先删除原配置再按新描述重新配置
+func renewCommands(entry, renewed *nat.NATEntry) []string {
+	return []string{
+		"system-view",
+		"interface " + entry.Interface,
+		"undo nat server " + globalClause(entry),
+		natServerCommand(renewed),
+		"return",
+	}
+}
+
+// restoreCommands 构建在接口上重新应用备份配置行的命令序列
+func restoreCommands(interfaceName, configLine string) []string {
+	return []string{
+		"system-view",
+		"interface " + interfaceName,
+		configLine,
+		"return",
+	}
+}
+
+// findConfigLine 在接口配置中查找条目对应的 nat server 配置行
+func findConfigLine(config string, entry *nat.NATEntry) (string, bool) {
+	prefix := "nat server " + globalClause(entry) + " "
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, prefix) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// createCommands 构建创建条目所需的命令序列，最后退回用户视图
+func createCommands(entry *nat.NATEntry) []string {
+	return []string{
+		"system-view",
+		"interface " + entry.Interface,
+		natServerCommand(entry),
+		"return",
+	}
+}
+
+// natServerCommand 构建完整的 nat server 配置命令
+func natServerCommand(entry *nat.NATEntry) string {
+	parts := []string{"nat server", globalClause(entry), "inside", localClause(entry)}
+	if entry.ACL != "" {
+		parts = append(parts, "acl", entry.ACL)
+	}
+	if entry.RuleName != "" {
+		parts = append(parts, "rule", entry.RuleName)
+	}
+	if entry.Description != "" {
+		parts = append(parts, "description", entry.Description)
+	}
+	return strings.Join(parts, " ")
+}
+
+// localClause 构建 nat server 命令中内网地址部分
+func localClause(entry *nat.NATEntry) string {
+	parts := []string{entry.LocalIP}
+	if entry.LocalIPEnd != "" {
+		parts = append(parts, entry.LocalIPEnd)
+	}
+
+	if hasPorts(protocolKeyword(entry.Protocol)) {
+		parts = append(parts, strconv.Itoa(entry.LocalPort))
+		if entry.LocalPortEnd != 0 {
+			parts = append(parts, strconv.Itoa(entry.LocalPortEnd))
+		}
+	}
+
+	if entry.LocalVPN != "" {
+		parts = append(parts, "vpn-instance", entry.LocalVPN)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// globalClause 构建 nat server 命令中协议和外网地址部分，undo 命令只需要这一部分
+func globalClause(entry *nat.NATEntry) string {
+	var parts []string
+
+	protocol := protocolKeyword(entry.Protocol)
+	if protocol != "" {
+		parts = append(parts, "protocol", protocol)
+	}
+
+	parts = append(parts, "global")
+	switch entry.GlobalInterface {
+	case "":
+		parts = append(parts, entry.GlobalIP)
+		if entry.GlobalIPEnd != "" {
+			parts = append(parts, entry.GlobalIPEnd)
+		}
+	case "current-interface":
+		parts = append(parts, "current-interface")
+	default:
+		parts = append(parts, "interface", entry.GlobalInterface)
+	}
+
+	if hasPorts(protocol) {
+		parts = append(parts, strconv.Itoa(entry.GlobalPort))
+		if entry.GlobalPortEnd != 0 {
+			parts = append(parts, strconv.Itoa(entry.GlobalPortEnd))
+		}
+	}
+
+	if entry.GlobalVPN != "" {
+		parts = append(parts, "vpn-instance", entry.GlobalVPN)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// protocolKeyword 转换为命令中的协议关键字，ANY不带protocol参数
+func protocolKeyword(protocol string) string {
+	if protocol == "" || strings.EqualFold(protocol, "ANY") {
+		return ""
+	}
+	return strings.ToLower(protocol)
+}
+
+// hasPorts 只有TCP和UDP需要指定端口
+func hasPorts(protocol string) bool {
+	return protocol == "tcp" || protocol == "udp"
+}
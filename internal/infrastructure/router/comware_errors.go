@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// CommandError Comware命令输出中的错误信息
+type CommandError struct {
+	Command string // 出错的命令
+	Message string // 路由器返回的错误信息
+	Kind    error  // 错误类型，见 nat.Err*
+}
+
+// Error 实现error接口
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%v: %s (命令: %s)", e.Kind, e.Message, e.Command)
+}
+
+// Unwrap 支持 errors.Is 判断错误类型
+func (e *CommandError) Unwrap() error {
+	return e.Kind
+}
+
+// errorRule 错误信息匹配规则
+type errorRule struct {
+	kind    error
+	pattern *regexp.Regexp
+}
+
+// errorRules 按顺序匹配错误信息（不含开头的%），越具体的规则越靠前。
+// 关键词按整词匹配，语法错误只匹配Comware固定的句首，避免描述等普通内容中的单词被误判
+var errorRules = []errorRule{
+	{nat.ErrEntryNotFound, regexp.MustCompile(`(?i)\b(does not exist|not exist|no such|not found)\b`)},
+	{nat.ErrPermissionDenied, regexp.MustCompile(`(?i)\b(permission denied|authorization failed|no permission|not authorized)\b`)},
+	{nat.ErrResourceBusy, regexp.MustCompile(`(?i)\b(system is busy|is busy|try again later|is being (processed|executed|configured|saved)|is locked|locked by)\b`)},
+	{nat.ErrCommandSyntax, regexp.MustCompile(`(?i)^(unrecognized command|incomplete command|too many parameters|wrong parameter|ambiguous command|invalid)\b`)},
+}
+
+// errorMarkerPattern Comware的错误提示以"% "开头，如 "% Unrecognized command found at '^' position."；
+// info-center 日志同样以%开头但紧跟时间或序号（如 "%Oct 16 10:00:00:000 2026 H3C SHELL/5/SHELL_LOGIN: ..."），不是错误
+var errorMarkerPattern = regexp.MustCompile(`^%\s+(\S.*)$`)
+
+// messagePattern 不以%开头的错误提示，只匹配整句，避免误判描述等普通输出
+var messagePattern = regexp.MustCompile(`(?i)^(the .+ does not exist\.?|permission denied\.?|system is busy.*|error: .+)$`)
+
+// classifyOutput 检查命令输出中的Comware错误信息，没有错误时返回nil
+func classifyOutput(cmd, output string) error {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		message := line
+		if m := errorMarkerPattern.FindStringSubmatch(line); m != nil {
+			message = m[1]
+		} else if !messagePattern.MatchString(line) {
+			continue
+		}
+
+		for _, rule := range errorRules {
+			if rule.pattern.MatchString(message) {
+				return &CommandError{Command: cmd, Message: line, Kind: rule.kind}
+			}
+		}
+		return &CommandError{Command: cmd, Message: line, Kind: nat.ErrCommandFailed}
+	}
+	return nil
+}
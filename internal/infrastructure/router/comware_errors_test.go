@@ -0,0 +1,55 @@
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+func TestClassifyOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   error // 为nil表示没有错误
+	}{
+		{"无输出", "", nil},
+		{"普通输出", "<H3C>display clock\n10:00:00.000 UTC Fri 10/16/2026", nil},
+		{"命令不存在", "                 ^\n % Unrecognized command found at '^' position.", nat.ErrCommandSyntax},
+		{"命令不完整", "% Incomplete command found at '^' position.", nat.ErrCommandSyntax},
+		{"参数过多", "% Too many parameters found at '^' position.", nat.ErrCommandSyntax},
+		{"参数错误", "% Wrong parameter found at '^' position.", nat.ErrCommandSyntax},
+		{"命令有歧义", "% Ambiguous command found at '^' position.", nat.ErrCommandSyntax},
+		{"参数无效", "% Invalid IP address.", nat.ErrCommandSyntax},
+		{"条目不存在", "% The NAT server configuration does not exist.", nat.ErrEntryNotFound},
+		{"不带%的条目不存在", "The NAT server configuration does not exist.", nat.ErrEntryNotFound},
+		{"权限不足", "% Permission denied.", nat.ErrPermissionDenied},
+		{"系统忙", "% System is busy, please try again later.", nat.ErrResourceBusy},
+		{"配置被锁定", "% The configuration is locked by another user.", nat.ErrResourceBusy},
+		{"其他错误", "% Failed to add the NAT server.", nat.ErrCommandFailed},
+		{"Error开头", "Error: Operation failed.", nat.ErrCommandFailed},
+
+		// info-center 日志以%开头但不是错误
+		{"登录日志", "%Oct 16 10:00:00:000 2026 H3C SHELL/5/SHELL_LOGIN: admin logged in from 10.0.0.1.", nil},
+		{"带序号的日志", "%@123%Oct 16 10:00:00:000 2026 H3C NAT/6/NAT_SERVER_INVALID: invalid mapping removed.", nil},
+		{"删除时的日志", "[H3C-GigabitEthernet0/0]undo nat server protocol tcp global 1.1.1.1 8080\n%Oct 16 10:00:01:000 2026 H3C SHELL/6/SHELL_CMD: -Line=vty0; Command is undo nat server", nil},
+
+		// 包含关键词的普通内容不是错误
+		{"描述中的关键词", " nat server protocol tcp global 1.1.1.1 8080 inside 10.0.0.1 80 description invalid-locked-host vp=991231", nil},
+		{"错误信息中间的invalid", "% Failed to apply the invalid-host profile.", nat.ErrCommandFailed},
+		{"带is being的状态", "% Interface is being shut down.", nat.ErrCommandFailed},
+	}
+
+	for _, tt := range tests {
+		err := classifyOutput("cmd", tt.output)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: classifyOutput() = %v, 期望 nil", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: classifyOutput() = %v, 期望 %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultMaxSessions 单个连接上允许同时打开的会话数，避免占满路由器VTY
+	defaultMaxSessions = 2
+	// defaultDialRetries 连接断开后的最大重连次数
+	defaultDialRetries = 3
+	// defaultBackoff 首次重连前的等待时间，之后按倍数增长
+	defaultBackoff = time.Second
+)
+
+// Hop 连接链路中的一跳
+type Hop struct {
+	Addr   string // host:port
+	Config *ssh.ClientConfig
+}
+
+// ConnManager SSH连接管理器，一次运行内复用同一个已认证的连接
+type ConnManager struct {
+	addr    string
+	config  *ssh.ClientConfig
+	jumps   []Hop // 跳板机，按顺序逐跳建立隧道
+	retries int
+	backoff time.Duration
+
+	sessions chan struct{} // 会话并发上限
+	codec    *Codec        // CLI的文本编码，连接上的所有shell共用识别结果
+
+	mu      sync.Mutex
+	client  *ssh.Client
+	chain   []*ssh.Client // 已建立的跳板机连接，与client一起关闭
+	dialing *dialCall     // 正在进行的拨号，并发的调用方等待其结果而不是各自拨号
+	closed  bool
+}
+
+// dialCall 一次拨号，done关闭后err为拨号结果
+type dialCall struct {
+	done      chan struct{}
+	err       error
+	cancelled bool // 因发起拨号的调用方ctx取消而失败，等待的调用方需要重新拨号
+}
+
+// NewConnManager 创建SSH连接管理器，jumps为空时直连目标
+func NewConnManager(target Hop, jumps []Hop, maxSessions int) *ConnManager {
+	if maxSessions <= 0 {
+		maxSessions = defaultMaxSessions
+	}
+	return &ConnManager{
+		addr:     target.Addr,
+		config:   target.Config,
+		jumps:    jumps,
+		retries:  defaultDialRetries,
+		backoff:  defaultBackoff,
+		sessions: make(chan struct{}, maxSessions),
+		codec:    NewCodec(""),
+	}
+}
+
+// WithSession 在共享连接上打开一个会话并执行fn，连接失效时自动重连。
+// ctx取消时关闭会话，fn中阻塞的读写随之返回
+func (m *ConnManager) WithSession(ctx context.Context, fn func(session *ssh.Session) error) error {
+	select {
+	case m.sessions <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("等待SSH会话已取消: %w", ctx.Err())
+	}
+	defer func() { <-m.sessions }()
+
+	session, err := m.newSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	if err := fn(session); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("操作已取消: %w", ctx.Err())
+		}
+		return err
+	}
+	return nil
+}
+
+// Close 关闭底层连接，之后的调用都会失败
+func (m *ConnManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	return m.closeLocked()
+}
+
+// closeLocked 关闭目标连接及所有跳板机连接，调用方需持有锁
+func (m *ConnManager) closeLocked() error {
+	err := closeClients(m.client, m.chain)
+	m.client = nil
+	m.chain = nil
+	return err
+}
+
+// closeClients 关闭目标连接，再从近到远关闭跳板机连接，返回关闭目标连接的错误
+func closeClients(client *ssh.Client, chain []*ssh.Client) error {
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].Close()
+	}
+	return err
+}
+
+// newSession 从当前连接创建会话，失败时丢弃连接并重连一次
+func (m *ConnManager) newSession(ctx context.Context) (*ssh.Session, error) {
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	// 会话创建失败通常意味着连接已被路由器断开
+	log.Printf("SSH会话创建失败，准备重新连接 %s: %v", m.addr, err)
+	m.invalidate(client)
+
+	client, err = m.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	session, err = client.NewSession()
+	if err != nil {
+		m.invalidate(client)
+		return nil, fmt.Errorf("创建SSH会话失败: %v", err)
+	}
+	return session, nil
+}
+
+// getClient 返回已建立的连接，没有时拨号。同一时刻只有一个调用方拨号，
+// 拨号在锁外进行，其他调用方等待拨号结果或自己的ctx取消
+func (m *ConnManager) getClient(ctx context.Context) (*ssh.Client, error) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("SSH连接已关闭")
+		}
+		if m.client != nil {
+			client := m.client
+			m.mu.Unlock()
+			return client, nil
+		}
+
+		if call := m.dialing; call != nil {
+			m.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, fmt.Errorf("连接路由器已取消: %w", ctx.Err())
+			}
+			if call.err != nil && !call.cancelled {
+				return nil, call.err
+			}
+			continue
+		}
+
+		call := &dialCall{done: make(chan struct{})}
+		m.dialing = call
+		m.mu.Unlock()
+
+		client, chain, err := m.dialWithRetry(ctx)
+
+		m.mu.Lock()
+		m.dialing = nil
+		if err == nil && m.closed {
+			closeClients(client, chain)
+			client, err = nil, fmt.Errorf("SSH连接已关闭")
+		}
+		if err == nil {
+			m.client = client
+			m.chain = chain
+		}
+		call.err = err
+		call.cancelled = ctx.Err() != nil
+		close(call.done)
+		m.mu.Unlock()
+		return client, err
+	}
+}
+
+// dialWithRetry 按退避策略拨号，ctx取消时停止重试
+func (m *ConnManager) dialWithRetry(ctx context.Context) (*ssh.Client, []*ssh.Client, error) {
+	var lastErr error
+	wait := m.backoff
+	for attempt := 0; attempt <= m.retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("第 %d 次重连 %s，等待 %v", attempt, m.addr, wait)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, nil, fmt.Errorf("连接路由器已取消: %w", ctx.Err())
+			}
+			wait *= 2
+		}
+
+		client, chain, err := m.dial(ctx)
+		if err == nil {
+			return client, chain, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("连接路由器已取消: %w", ctx.Err())
+		}
+		// 主机密钥不受信任或认证失败时重试没有意义，反而会继续与可疑主机握手或触发账号锁定
+		if isPermanentDialError(err) {
+			break
+		}
+	}
+
+	return nil, nil, fmt.Errorf("连接路由器失败: %w", lastErr)
+}
+
+// invalidate 丢弃已失效的连接，避免后续调用继续使用
+func (m *ConnManager) invalidate(client *ssh.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.client == client {
+		m.closeLocked()
+	}
+}
+
+// dial 经过跳板机链拨号到目标，返回目标连接和途经的跳板机连接
+func (m *ConnManager) dial(ctx context.Context) (*ssh.Client, []*ssh.Client, error) {
+	hops := append(append([]Hop{}, m.jumps...), Hop{Addr: m.addr, Config: m.config})
+
+	var chain []*ssh.Client
+	closeChain := func() {
+		for i := len(chain) - 1; i >= 0; i-- {
+			chain[i].Close()
+		}
+	}
+
+	var client *ssh.Client
+	for i, hop := range hops {
+		var conn net.Conn
+		var err error
+		if i == 0 {
+			dialer := &net.Dialer{Timeout: hop.Config.Timeout}
+			conn, err = dialer.DialContext(ctx, "tcp", hop.Addr)
+		} else {
+			conn, err = chain[len(chain)-1].DialContext(ctx, "tcp", hop.Addr)
+		}
+		if err == nil {
+			client, err = handshake(ctx, conn, hop)
+		}
+		if err != nil {
+			closeChain()
+			if i < len(hops)-1 {
+				return nil, nil, fmt.Errorf("连接跳板机 %s 失败: %w", hop.Addr, err)
+			}
+			return nil, nil, err
+		}
+		chain = append(chain, client)
+	}
+
+	return client, chain[:len(chain)-1], nil
+}
+
+// AuthError 路由器拒绝了所有认证方式
+type AuthError struct {
+	Addr string
+	Err  error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("认证失败 %s: %v", e.Addr, e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// handshake 在已建立的TCP连接上完成SSH握手，ctx取消时关闭连接中断握手。
+// 主机密钥校验通过后握手只剩认证，此时除连接中断以外的失败都是认证被拒绝，返回 *AuthError
+func handshake(ctx context.Context, conn net.Conn, hop Hop) (*ssh.Client, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var verified atomic.Bool
+	config := *hop.Config
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := hop.Config.HostKeyCallback(hostname, remote, key); err != nil {
+			return err
+		}
+		verified.Store(true)
+		return nil
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, hop.Addr, &config)
+	if err != nil {
+		conn.Close()
+		if verified.Load() && ctx.Err() == nil && !isConnError(err) {
+			return nil, &AuthError{Addr: hop.Addr, Err: err}
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// isConnError 判断是否为连接中断，中断时可以重试
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.As(err, &netErr)
+}
+
+// isPermanentDialError 判断拨号失败是否不应重试：主机密钥不受信任或认证被拒绝
+func isPermanentDialError(err error) bool {
+	var hostKeyErr *HostKeyError
+	var authErr *AuthError
+	return errors.As(err, &hostKeyErr) || errors.As(err, &authErr)
+}
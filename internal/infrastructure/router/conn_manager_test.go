@@ -0,0 +1,231 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"h3c-nat-manager/internal/infrastructure/config"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+// newSimConn 创建连接到模拟器的连接管理器
+func newSimConn(t *testing.T, addr, fingerprint string) *ConnManager {
+	t.Helper()
+	callback, err := (&HostKeyPolicy{Fingerprint: fingerprint}).Callback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnManager(Hop{Addr: addr, Config: &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: callback,
+		Timeout:         5 * time.Second,
+	}}, nil, 0)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// noop 不做任何操作的会话
+func noop(session *ssh.Session) error { return nil }
+
+func TestConnManagerReusesConnection(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	conn := newSimConn(t, sim.Addr(), sim.Fingerprint())
+
+	// 并发的调用方共用一次拨号
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- conn.WithSession(context.Background(), noop)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("WithSession() = %v", err)
+		}
+	}
+	if err := conn.WithSession(context.Background(), noop); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sim.Logins(); got != 1 {
+		t.Errorf("登录次数 = %d, 期望所有会话复用一个连接", got)
+	}
+}
+
+func TestConnManagerReconnectsAfterDrop(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	conn := newSimConn(t, sim.Addr(), sim.Fingerprint())
+
+	if err := conn.WithSession(context.Background(), noop); err != nil {
+		t.Fatal(err)
+	}
+	sim.DropConnections()
+
+	// 连接被路由器断开后重连一次，之后继续复用新连接
+	for i := 0; i < 3; i++ {
+		if err := conn.WithSession(context.Background(), noop); err != nil {
+			t.Fatalf("连接断开后 WithSession() = %v", err)
+		}
+	}
+	if got := sim.Logins(); got != 2 {
+		t.Errorf("登录次数 = %d, 期望断开后只重连一次", got)
+	}
+}
+
+func TestConnManagerClose(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	conn := newSimConn(t, sim.Addr(), sim.Fingerprint())
+
+	if err := conn.WithSession(context.Background(), noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+
+	if err := conn.WithSession(context.Background(), noop); err == nil {
+		t.Error("关闭后 WithSession() 应返回错误")
+	}
+	if got := sim.Logins(); got != 1 {
+		t.Errorf("登录次数 = %d, 关闭后不应重新连接", got)
+	}
+}
+
+func TestConnManagerWaitHonoursContext(t *testing.T) {
+	// 接受连接但不进行SSH握手，使拨号一直阻塞
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		var held []net.Conn
+		defer func() {
+			for _, c := range held {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			held = append(held, c)
+		}
+	}()
+	conn := newSimConn(t, listener.Addr().String(), "SHA256:unused")
+
+	dialCtx, cancelDial := context.WithCancel(context.Background())
+	dialErr := make(chan error, 1)
+	go func() { dialErr <- conn.WithSession(dialCtx, noop) }()
+
+	// 等待第一个调用方开始拨号
+	for deadline := time.Now().Add(time.Second); ; {
+		conn.mu.Lock()
+		dialing := conn.dialing != nil
+		conn.mu.Unlock()
+		if dialing {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("第一个调用方没有开始拨号")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 等待拨号的调用方在自己的ctx超时后返回，不被拨号阻塞
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = conn.WithSession(ctx, noop)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithSession() = %v, 期望 context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("等待拨号的调用方耗时 %v, 应在自己的ctx超时后返回", elapsed)
+	}
+
+	cancelDial()
+	if err := <-dialErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("拨号的调用方 WithSession() = %v, 期望 context.Canceled", err)
+	}
+}
+
+func TestJumpHostChain(t *testing.T) {
+	newSim := func(opts simulator.Options) *simulator.Server {
+		sim, err := simulator.New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		return sim
+	}
+	target := newSim(simulator.Options{User: "admin", Password: "secret"})
+	if err := target.AddMapping("GigabitEthernet0/0", "nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description web vp=991231"); err != nil {
+		t.Fatal(err)
+	}
+	// 每个跳板机使用自己的账号
+	first := newSim(simulator.Options{User: "jump1", Password: "pass1", AllowForwarding: true})
+	second := newSim(simulator.Options{User: "jump2", Password: "pass2", AllowForwarding: true})
+
+	// 路由器使用主机名，由最后一个跳板机解析
+	client, err := NewH3CClientWithConfig(&config.RouterConfig{
+		SSHAuthConfig:      config.SSHAuthConfig{User: "admin", Passwd: "secret"},
+		Host:               "localhost",
+		Port:               target.Port(),
+		ExpiryTime:         config.ExpiryTimeConfig{Hour: 21, Minute: 30},
+		HostKeyFingerprint: target.Fingerprint(),
+		JumpHosts: []config.JumpHostConfig{
+			{SSHAuthConfig: config.SSHAuthConfig{User: "jump1", Passwd: "pass1"}, Host: first.Host(), Port: first.Port(), HostKeyFingerprint: first.Fingerprint()},
+			{SSHAuthConfig: config.SSHAuthConfig{User: "jump2", Passwd: "pass2"}, Host: second.Host(), Port: second.Port(), HostKeyFingerprint: second.Fingerprint()},
+		},
+	}, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	entries, err := client.GetAllEntries(context.Background())
+	if err != nil {
+		t.Fatalf("经跳板机读取条目失败: %v", err)
+	}
+	if len(entries) != 1 || entries[0].GetGlobalAddress() != "117.149.14.2:7935" {
+		t.Errorf("读取的条目 = %+v", entries)
+	}
+
+	// 第一个跳板机只转发到第二个跳板机，第二个跳板机转发到路由器
+	if got := first.Forwards(); len(got) != 1 || got[0] != second.Addr() {
+		t.Errorf("第一个跳板机的转发 = %v, 期望 [%s]", got, second.Addr())
+	}
+	wantTarget := net.JoinHostPort("localhost", strconv.Itoa(target.Port()))
+	if got := second.Forwards(); len(got) != 1 || got[0] != wantTarget {
+		t.Errorf("第二个跳板机的转发 = %v, 期望 [%s]", got, wantTarget)
+	}
+	if first.Logins() != 1 || second.Logins() != 1 || target.Logins() != 1 {
+		t.Errorf("登录次数 = %d/%d/%d, 期望每一跳各登录一次", first.Logins(), second.Logins(), target.Logins())
+	}
+}
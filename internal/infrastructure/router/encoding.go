@@ -0,0 +1,103 @@
+package router
+
+import (
+	"errors"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+// decodeOutput 解码路由器输出。Comware CLI 的中文描述按 GBK/GB18030 编码输出，
+// 直接当作UTF-8处理会变成乱码；已是合法UTF-8时原样返回
+func decodeOutput(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+
+	// GB18030 是 GBK 的超集，同时兼容两种编码
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// errEncodingUnknown 自动识别尚无结果时发送非ASCII文本的错误。
+// 此时按UTF-8写入的中文在GBK设备上读回会变成乱码，所以拒绝而不是猜测
+var errEncodingUnknown = errors.New("尚未从路由器输出中识别出编码，不能发送中文等非ASCII字符，请在路由器配置中指定 encoding: gbk 或 utf-8")
+
+// Codec 路由器CLI的文本编码，输出按此解码，发送的命令按此编码，保证写入的描述读回时不变。
+// 未配置编码时自动识别：读到非UTF-8的输出后认为设备使用GBK，读到含非ASCII字符的合法UTF-8输出后
+// 认为设备使用UTF-8；识别出结果之前只能发送ASCII文本
+type Codec struct {
+	mu       sync.Mutex
+	auto     bool // 按输出自动识别
+	detected bool // 自动识别已有结果
+	gbk      bool // 使用GBK(GB18030)编码
+}
+
+// NewCodec 按路由器配置的 encoding 创建编码，为空时自动识别
+func NewCodec(encoding string) *Codec {
+	switch encoding {
+	case config.EncodingGBK:
+		return &Codec{gbk: true}
+	case config.EncodingUTF8:
+		return &Codec{}
+	default:
+		return &Codec{auto: true}
+	}
+}
+
+// state 返回是否按GBK编码，以及编码是否已确定（已配置或已识别）
+func (c *Codec) state() (gbk, known bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gbk, !c.auto || c.detected
+}
+
+// Decode 解码路由器输出
+func (c *Codec) Decode(data []byte) string {
+	c.mu.Lock()
+	if c.auto && !c.detected {
+		if !utf8.Valid(data) {
+			c.gbk, c.detected = true, true
+		} else if !isASCII(string(data)) {
+			c.detected = true
+		}
+	}
+	gbk := c.gbk
+	c.mu.Unlock()
+
+	if !gbk {
+		return string(data)
+	}
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// Encode 按路由器编码转换要发送的文本，编码尚未确定时非ASCII文本返回错误
+func (c *Codec) Encode(text string) ([]byte, error) {
+	gbk, known := c.state()
+	if !known && !isASCII(text) {
+		return nil, errEncodingUnknown
+	}
+	if !gbk {
+		return []byte(text), nil
+	}
+	return simplifiedchinese.GB18030.NewEncoder().Bytes([]byte(text))
+}
+
+// isASCII 文本是否只包含ASCII字符，ASCII在GBK和UTF-8下编码相同
+func isASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
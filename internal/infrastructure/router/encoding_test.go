@@ -0,0 +1,228 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/config"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+// toGBK 把文本转换为GBK编码，模拟设备上保存的配置
+func toGBK(t *testing.T, text string) string {
+	t.Helper()
+	data, err := simplifiedchinese.GB18030.NewEncoder().String(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// rawLine 返回模拟器NAT表中外网端口对应的原始配置行
+func rawLine(sim *simulator.Server, globalPort string) string {
+	for _, m := range sim.Mappings() {
+		if strings.Contains(m.Line, " "+globalPort+" inside ") {
+			return m.Line
+		}
+	}
+	return ""
+}
+
+func TestGBKDescriptionRoundTrip(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	// 设备按GBK保存中文描述
+	seed := []string{
+		"nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description 测试服务 vp=991231",
+		"nat server protocol tcp global 117.149.14.2 8080 inside 192.168.1.113 80 description 巡检系统 vp=991231",
+	}
+	for _, line := range seed {
+		if err := sim.AddMapping("GigabitEthernet0/0", toGBK(t, line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := NewH3CClientWithConfig(&config.RouterConfig{
+		SSHAuthConfig:      config.SSHAuthConfig{User: "admin", Passwd: "secret"},
+		Host:               sim.Host(),
+		Port:               sim.Port(),
+		ExpiryTime:         config.ExpiryTimeConfig{Hour: 21, Minute: 30},
+		HostKeyFingerprint: sim.Fingerprint(),
+	}, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	entries, err := client.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Description != "测试服务 vp=991231" {
+		t.Fatalf("读取的条目 = %+v", entries)
+	}
+
+	// 续期后设备上的描述仍为GBK，再次读取得到相同的中文
+	expiry := time.Date(2100, 1, 31, 0, 0, 0, 0, time.Local)
+	if err := client.RenewEntry(ctx, entries[0], expiry); err != nil {
+		t.Fatal(err)
+	}
+	want := toGBK(t, "nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description 测试服务 vp=000131")
+	if got := rawLine(sim, "7935"); got != want {
+		t.Errorf("续期后设备上的配置行 = %q, 期望GBK编码的 %q", got, want)
+	}
+
+	// 按备份的配置行删除后恢复，描述不变
+	line, err := client.BackupEntry(ctx, entries[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteEntry(ctx, entries[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RestoreEntry(ctx, "GigabitEthernet0/0", line); err != nil {
+		t.Fatal(err)
+	}
+	if got := rawLine(sim, "8080"); got != toGBK(t, seed[1]) {
+		t.Errorf("恢复后设备上的配置行 = %q, 期望 %q", got, toGBK(t, seed[1]))
+	}
+
+	entries, err = client.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptions := map[string]string{}
+	for _, entry := range entries {
+		descriptions[entry.GetGlobalAddress()] = entry.Description
+	}
+	if descriptions["117.149.14.2:7935"] != "测试服务 vp=000131" || descriptions["117.149.14.2:8080"] != "巡检系统 vp=991231" {
+		t.Errorf("再次读取的描述 = %v", descriptions)
+	}
+
+	// 描述长度按GBK字节数计算：25个汉字在GBK下为50字节，UTF-8下为75字节
+	long := &nat.NATEntry{
+		Interface:   "GigabitEthernet0/0",
+		Protocol:    "TCP",
+		GlobalIP:    "117.149.14.2",
+		GlobalPort:  9000,
+		LocalIP:     "192.168.1.114",
+		LocalPort:   9000,
+		Description: strings.Repeat("中", 25) + " vp=991231",
+	}
+	if err := client.CreateEntry(ctx, long); err != nil {
+		t.Errorf("GBK编码后不超过 %d 字节的描述被拒绝: %v", nat.MaxDescriptionLength, err)
+	}
+	long.GlobalPort = 9001
+	long.Description = strings.Repeat("中", 30) + " vp=991231"
+	if err := client.CreateEntry(ctx, long); err == nil {
+		t.Error("GBK编码后超过长度限制的描述应被拒绝")
+	}
+}
+
+func TestCodecAutoDetect(t *testing.T) {
+	// 识别出编码之前不发送非ASCII文本，ASCII在两种编码下相同
+	codec := NewCodec("")
+	if _, err := codec.Encode("测试"); !errors.Is(err, errEncodingUnknown) {
+		t.Errorf("识别之前 Encode(中文) = %v, 期望 errEncodingUnknown", err)
+	}
+	if data, err := codec.Encode("web vp=991231"); err != nil || string(data) != "web vp=991231" {
+		t.Errorf("识别之前 Encode(ASCII) = %q, %v", data, err)
+	}
+	// 只有ASCII的输出无法区分编码
+	codec.Decode([]byte("description web vp=991231"))
+	if _, err := codec.Encode("测试"); err == nil {
+		t.Error("只读到ASCII输出时 Encode(中文) 应返回错误")
+	}
+
+	// 读到GBK输出后按GBK发送
+	codec.Decode([]byte(toGBK(t, "description 测试服务")))
+	if data, err := codec.Encode("巡检"); err != nil || string(data) != toGBK(t, "巡检") {
+		t.Errorf("识别为GBK后 Encode() = %q, %v", data, err)
+	}
+
+	// 读到含中文的UTF-8输出后按UTF-8发送
+	codec = NewCodec("")
+	codec.Decode([]byte("description 测试服务"))
+	if data, err := codec.Encode("巡检"); err != nil || string(data) != "巡检" {
+		t.Errorf("识别为UTF-8后 Encode() = %q, %v", data, err)
+	}
+
+	// 配置了编码时不需要识别
+	if data, err := NewCodec(config.EncodingGBK).Encode("巡检"); err != nil || string(data) != toGBK(t, "巡检") {
+		t.Errorf("encoding: gbk 时 Encode() = %q, %v", data, err)
+	}
+	if data, err := NewCodec(config.EncodingUTF8).Encode("巡检"); err != nil || string(data) != "巡检" {
+		t.Errorf("encoding: utf-8 时 Encode() = %q, %v", data, err)
+	}
+}
+
+func TestAutoEncodingRejectsChineseBeforeDetection(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	if err := sim.AddMapping("GigabitEthernet0/0", "nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description web vp=991231"); err != nil {
+		t.Fatal(err)
+	}
+
+	newClient := func(encoding string) *H3CClient {
+		client, err := NewH3CClientWithConfig(&config.RouterConfig{
+			SSHAuthConfig:      config.SSHAuthConfig{User: "admin", Passwd: "secret"},
+			Host:               sim.Host(),
+			Port:               sim.Port(),
+			ExpiryTime:         config.ExpiryTimeConfig{Hour: 21, Minute: 30},
+			HostKeyFingerprint: sim.Fingerprint(),
+			Encoding:           encoding,
+		}, ClientOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+	entry := &nat.NATEntry{
+		Interface:   "GigabitEthernet0/0",
+		Protocol:    "TCP",
+		GlobalIP:    "117.149.14.2",
+		GlobalPort:  9000,
+		LocalIP:     "192.168.1.114",
+		LocalPort:   9000,
+		Description: "测试服务 vp=991231",
+	}
+
+	// 设备上只有ASCII描述，无法判断编码，不按UTF-8猜测写入中文
+	ctx := context.Background()
+	client := newClient("")
+	if _, err := client.GetAllEntries(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateEntry(ctx, entry); !errors.Is(err, errEncodingUnknown) {
+		t.Errorf("编码未识别时 CreateEntry() = %v, 期望 errEncodingUnknown", err)
+	}
+	if err := client.RestoreEntry(ctx, "GigabitEthernet0/0", natServerCommand(entry)); !errors.Is(err, errEncodingUnknown) {
+		t.Errorf("编码未识别时 RestoreEntry() = %v, 期望 errEncodingUnknown", err)
+	}
+	if got := rawLine(sim, "9000"); got != "" {
+		t.Errorf("编码未识别时写入了配置行 %q", got)
+	}
+
+	// 配置 encoding 后按指定编码写入
+	if err := newClient(config.EncodingGBK).CreateEntry(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	want := toGBK(t, "nat server protocol tcp global 117.149.14.2 9000 inside 192.168.1.114 9000 description 测试服务 vp=991231")
+	if got := rawLine(sim, "9000"); got != want {
+		t.Errorf("encoding: gbk 时写入的配置行 = %q, 期望 %q", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+// errReadOnly 离线仓储未配置删除记录文件时的修改操作错误
+var errReadOnly = errors.New("离线模式为只读，使用 --record-deletions 记录删除")
+
+// FileRepository 基于保存的 display nat server 输出文件的离线仓储，
+// 与 H3CClient 使用同一个解析器，用于复现解析问题和在不连接路由器的情况下验证配置
+type FileRepository struct {
+	inputFile  string
+	recordFile string // 删除记录文件，为空时只读
+	expiryHour int
+	expiryMin  int
+	location   *time.Location
+	clock      nat.Clock // 删除记录中的时间，与判断过期使用同一个时钟
+	dryRun     bool
+
+	mu      sync.Mutex
+	deleted []*nat.NATEntry // 本次运行已记录删除的条目，之后读取时不再返回
+}
+
+// NewFileRepository 创建离线仓储，recordFile为空时拒绝删除，clock为空时使用系统时钟
+func NewFileRepository(inputFile, recordFile string, routerConfig *config.RouterConfig, clock nat.Clock, dryRun bool) *FileRepository {
+	if clock == nil {
+		clock = nat.SystemClock{}
+	}
+	return &FileRepository{
+		inputFile:  inputFile,
+		recordFile: recordFile,
+		expiryHour: routerConfig.ExpiryTime.Hour,
+		expiryMin:  routerConfig.ExpiryTime.Minute,
+		location:   routerConfig.Location(),
+		clock:      clock,
+		dryRun:     dryRun,
+	}
+}
+
+// GetAllEntries 从文件读取并解析NAT映射条目，已记录删除的条目不再返回
+func (r *FileRepository) GetAllEntries(ctx context.Context) ([]*nat.NATEntry, error) {
+	data, err := os.ReadFile(r.inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取离线文件失败: %v", err)
+	}
+	fmt.Printf("读取离线文件 %s，长度: %d 字节\n", r.inputFile, len(data))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []*nat.NATEntry
+	for _, entry := range parseEntries(decodeOutput(data), r.expiryHour, r.expiryMin, r.location) {
+		if !r.isDeleted(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// CreateEntry 离线模式不支持创建
+func (r *FileRepository) CreateEntry(ctx context.Context, entry *nat.NATEntry) error {
+	return r.unsupported(createCommands(entry))
+}
+
+// DeleteEntry 将删除命令追加到删除记录文件
+func (r *FileRepository) DeleteEntry(ctx context.Context, entry *nat.NATEntry) error {
+	cmds := deleteCommands(entry)
+	if r.dryRun {
+		printPlan(r.inputFile, cmds)
+		return nil
+	}
+	if r.recordFile == "" {
+		return errReadOnly
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	comment := fmt.Sprintf("# %s 删除 %s -> %s (%s)", r.clock.Now().In(r.location).Format(time.DateTime),
+		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+	if err := r.appendRecord(comment, cmds); err != nil {
+		return err
+	}
+
+	r.deleted = append(r.deleted, entry)
+	fmt.Printf("已记录删除命令到 %s: %s\n", r.recordFile, strings.Join(cmds, " -> "))
+	return nil
+}
+
+// RenewEntry 离线模式不支持续期
+func (r *FileRepository) RenewEntry(ctx context.Context, entry *nat.NATEntry, expiry time.Time) error {
+	renewed := *entry
+	renewed.Description = nat.WithExpiryTag(entry.Description, expiry)
+	return r.unsupported(renewCommands(entry, &renewed))
+}
+
+// BackupEntry 离线文件中没有原始配置行，按解析结果重建。
+// 只读时直接返回错误，使调用方在写入备份归档之前就放弃删除
+func (r *FileRepository) BackupEntry(ctx context.Context, entry *nat.NATEntry) (string, error) {
+	if r.recordFile == "" && !r.dryRun {
+		return "", errReadOnly
+	}
+	return natServerCommand(entry), nil
+}
+
+// RestoreEntry 离线模式不支持恢复
+func (r *FileRepository) RestoreEntry(ctx context.Context, interfaceName, configLine string) error {
+	return r.unsupported(restoreCommands(interfaceName, configLine))
+}
+
+// SaveConfig 将保存命令追加到删除记录文件
+func (r *FileRepository) SaveConfig(ctx context.Context) error {
+	cmds := []string{"save force"}
+	if r.dryRun {
+		printPlan(r.inputFile, cmds)
+		return nil
+	}
+	if r.recordFile == "" {
+		return errReadOnly
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.appendRecord("", cmds)
+}
+
+// unsupported 演练模式下打印命令，否则返回不支持的错误
+func (r *FileRepository) unsupported(cmds []string) error {
+	if r.dryRun {
+		printPlan(r.inputFile, cmds)
+		return nil
+	}
+	return fmt.Errorf("离线模式只支持删除: %s", strings.Join(cmds, " -> "))
+}
+
+// appendRecord 追加一组命令，调用方持有锁
+func (r *FileRepository) appendRecord(comment string, cmds []string) error {
+	f, err := os.OpenFile(r.recordFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开删除记录文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	if comment != "" {
+		b.WriteString(comment + "\n")
+	}
+	for _, cmd := range cmds {
+		b.WriteString(cmd + "\n")
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		return fmt.Errorf("写入删除记录文件失败: %v", err)
+	}
+	return nil
+}
+
+// isDeleted 判断条目是否已记录删除，调用方持有锁
+func (r *FileRepository) isDeleted(entry *nat.NATEntry) bool {
+	for _, deleted := range r.deleted {
+		if deleted.SameMapping(entry) {
+			return true
+		}
+	}
+	return false
+}
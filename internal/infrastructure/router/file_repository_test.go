@@ -0,0 +1,86 @@
+package router
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+func TestFileRepositoryRecordsDeletion(t *testing.T) {
+	recordFile := filepath.Join(t.TempDir(), "deletions.txt")
+	routerConfig := &config.RouterConfig{
+		Name:       "offline",
+		ExpiryTime: config.ExpiryTimeConfig{Hour: 21, Minute: 30},
+		Timezone:   "Asia/Shanghai",
+	}
+	now := time.Date(2026, 1, 19, 1, 0, 0, 0, time.UTC)
+	repo := NewFileRepository("testdata/display_nat_server/basic.txt", recordFile, routerConfig, nat.FixedClock(now), false)
+
+	ctx := context.Background()
+	entries, err := repo.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("解析的条目 %d 条, 期望 3 条", len(entries))
+	}
+	deleted := entries[2]
+	if deleted.GetGlobalAddress() != "117.149.14.2:54188" || deleted.ExpiryDate.Format("2006-01-02 15:04") != "2025-12-31 21:30" {
+		t.Fatalf("解析的条目 = %+v", deleted)
+	}
+
+	if err := repo.DeleteEntry(ctx, deleted); err != nil {
+		t.Fatalf("DeleteEntry() = %v", err)
+	}
+
+	data, err := os.ReadFile(recordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 记录时间取自传入的时钟，按路由器时区显示
+	want := strings.Join([]string{
+		"# 2026-01-19 09:00:00 删除 117.149.14.2:54188 -> 192.168.1.109:22 (TCP)",
+		"system-view",
+		"interface GigabitEthernet0/0",
+		"undo nat server protocol tcp global 117.149.14.2 54188",
+		"return",
+	}, "\n") + "\n"
+	if string(data) != want {
+		t.Errorf("删除记录 =\n%s\n期望\n%s", data, want)
+	}
+
+	// 已记录删除的条目之后不再返回
+	entries, err = repo.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("删除后读取的条目 %d 条, 期望 2 条", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.SameMapping(deleted) {
+			t.Errorf("已记录删除的条目仍被返回: %+v", entry)
+		}
+	}
+}
+
+func TestFileRepositoryReadOnly(t *testing.T) {
+	repo := NewFileRepository("testdata/display_nat_server/basic.txt", "", &config.RouterConfig{}, nil, false)
+
+	entries, err := repo.GetAllEntries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.BackupEntry(context.Background(), entries[0]); err == nil {
+		t.Error("未配置删除记录文件时 BackupEntry() 应返回错误")
+	}
+	if err := repo.DeleteEntry(context.Background(), entries[0]); err == nil {
+		t.Error("未配置删除记录文件时 DeleteEntry() 应返回错误")
+	}
+}
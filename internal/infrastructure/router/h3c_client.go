@@ -1,226 +1,344 @@
 package router
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/config"
 )
 
 // H3CClient H3C路由器SSH客户端
 type H3CClient struct {
 	host       string
-	username   string
-	password   string
-	expiryHour int // 过期小时
-	expiryMin  int // 过期分钟
+	expiryHour int            // 过期小时
+	expiryMin  int            // 过期分钟
+	location   *time.Location // 路由器所在时区，过期日期按此时区解析
+
+	conn           *ConnManager  // 整个运行期间共享的SSH连接
+	closeAuth      func()        // 关闭认证过程中打开的资源，如SSH agent连接
+	dryRun         bool          // 只打印配置命令，不在路由器上执行
+	commandTimeout time.Duration // 单条命令等待提示符的超时
 }
 
-// NewH3CClient 创建H3C客户端
-func NewH3CClient(host, username, password string) *H3CClient {
-	return &H3CClient{
-		host:       host,
-		username:   username,
-		password:   password,
-		expiryHour: 21, // 默认21点
-		expiryMin:  30, // 默认30分
+// ClientOptions 创建客户端的运行选项
+type ClientOptions struct {
+	AcceptHostKey  bool          // 信任首次连接的主机密钥
+	DryRun         bool          // 只读取条目，修改类命令只打印不执行
+	ConnectTimeout time.Duration // SSH建立连接（含握手）的超时，为0时使用默认值
+	CommandTimeout time.Duration // 单条命令或NETCONF请求的超时，为0时使用默认值
+	MaxSessions    int           // 同时打开的会话数，为0时使用默认值
+}
+
+// defaultConnectTimeout SSH建立连接的默认超时时间
+const defaultConnectTimeout = 30 * time.Second
+
+// Client 连接路由器的NAT仓储，使用结束后需要关闭
+type Client interface {
+	nat.Repository
+	Close()
+}
+
+// NewClient 按路由器配置的 backend 创建CLI或NETCONF客户端
+func NewClient(routerConfig *config.RouterConfig, opts ClientOptions) (Client, error) {
+	if routerConfig.Backend == config.BackendNetconf {
+		return NewNetconfClientWithConfig(routerConfig, opts)
 	}
+	return NewH3CClientWithConfig(routerConfig, opts)
 }
 
-// NewH3CClientWithExpiryTime 创建带过期时间配置的H3C客户端
-func NewH3CClientWithExpiryTime(host, username, password string, expiryHour, expiryMin int) *H3CClient {
-	return &H3CClient{
-		host:       host,
-		username:   username,
-		password:   password,
-		expiryHour: expiryHour,
-		expiryMin:  expiryMin,
+// NewH3CClientWithConfig 根据路由器配置创建H3C客户端
+func NewH3CClientWithConfig(routerConfig *config.RouterConfig, opts ClientOptions) (*H3CClient, error) {
+	conn, closeAuth, err := newConnManager(routerConfig, routerConfig.Address(), opts)
+	if err != nil {
+		return nil, err
 	}
+
+	return &H3CClient{
+		host:           routerConfig.Host,
+		expiryHour:     routerConfig.ExpiryTime.Hour,
+		expiryMin:      routerConfig.ExpiryTime.Minute,
+		location:       routerConfig.Location(),
+		conn:           conn,
+		closeAuth:      closeAuth,
+		dryRun:         opts.DryRun,
+		commandTimeout: opts.CommandTimeout,
+	}, nil
 }
 
-// Close 关闭客户端（为了兼容优化后的接口）
-func (c *H3CClient) Close() {
-	// 原来的实现不需要关闭操作
+// newConnManager 按路由器配置建立到addr的连接管理器（含跳板机链），返回的closer用于释放认证资源
+func newConnManager(routerConfig *config.RouterConfig, addr string, opts ClientOptions) (*ConnManager, func(), error) {
+	var closers []func()
+	closeAuth := func() {
+		for _, closeFn := range closers {
+			closeFn()
+		}
+	}
+
+	// 跳板机与路由器共用known_hosts，单独配置指纹时以指纹为准
+	var jumps []Hop
+	for i := range routerConfig.JumpHosts {
+		jump := &routerConfig.JumpHosts[i]
+		hop, closeFn, err := newHop(jump.Address(), &jump.SSHAuthConfig, &HostKeyPolicy{
+			KnownHostsFile: routerConfig.KnownHosts,
+			Fingerprint:    jump.HostKeyFingerprint,
+			AcceptNew:      opts.AcceptHostKey,
+		}, opts.ConnectTimeout)
+		if err != nil {
+			closeAuth()
+			return nil, nil, fmt.Errorf("初始化跳板机 %s 失败: %v", jump.Address(), err)
+		}
+		closers = append(closers, closeFn)
+		jumps = append(jumps, hop)
+	}
+
+	target, closeFn, err := newHop(addr, &routerConfig.SSHAuthConfig, &HostKeyPolicy{
+		KnownHostsFile: routerConfig.KnownHosts,
+		Fingerprint:    routerConfig.HostKeyFingerprint,
+		AcceptNew:      opts.AcceptHostKey,
+	}, opts.ConnectTimeout)
+	if err != nil {
+		closeAuth()
+		return nil, nil, err
+	}
+	closers = append(closers, closeFn)
+
+	conn := NewConnManager(target, jumps, opts.MaxSessions)
+	conn.codec = NewCodec(routerConfig.Encoding)
+	return conn, closeAuth, nil
 }
 
-// GetAllEntries 获取所有NAT映射条目
-func (c *H3CClient) GetAllEntries() ([]*nat.NATEntry, error) {
-	fmt.Printf("正在连接路由器 %s...\n", c.host)
-	
-	conn, err := c.connect()
+// newHop 构建一跳的SSH配置，timeout为建立连接的超时，返回的closer用于释放认证资源
+func newHop(addr string, auth *config.SSHAuthConfig, policy *HostKeyPolicy, timeout time.Duration) (Hop, func(), error) {
+	if timeout <= 0 {
+		timeout = defaultConnectTimeout
+	}
+
+	hostKeyCallback, err := policy.Callback()
 	if err != nil {
-		return nil, fmt.Errorf("连接路由器失败: %v", err)
+		return Hop{}, nil, fmt.Errorf("初始化主机密钥校验失败: %v", err)
 	}
-	defer conn.Close()
 
-	fmt.Println("SSH连接成功，创建会话...")
-	
-	session, err := conn.NewSession()
+	methods, closeAuth, err := authMethods(auth)
 	if err != nil {
-		return nil, fmt.Errorf("创建SSH会话失败: %v", err)
+		return Hop{}, nil, fmt.Errorf("初始化SSH认证失败: %v", err)
+	}
+
+	return Hop{
+		Addr: addr,
+		Config: &ssh.ClientConfig{
+			User:            auth.User,
+			Auth:            methods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+	}, closeAuth, nil
+}
+
+// Close 关闭客户端持有的SSH连接
+func (c *H3CClient) Close() {
+	if err := c.conn.Close(); err != nil {
+		fmt.Printf("关闭SSH连接失败: %v\n", err)
 	}
-	defer session.Close()
+	c.closeAuth()
+}
+
+// GetAllEntries 获取所有NAT映射条目
+func (c *H3CClient) GetAllEntries(ctx context.Context) ([]*nat.NATEntry, error) {
+	fmt.Printf("正在查询路由器 %s...\n", c.host)
+
+	var output string
+	err := c.conn.WithShell(ctx, c.commandTimeout, func(shell *Shell) error {
+		fmt.Println("执行NAT查询命令...")
 
-	fmt.Println("执行NAT查询命令...")
-	
-	// 直接使用Output方法执行命令
-	output, err := session.Output("screen-length disable\ndisplay nat server")
+		outputs, err := shell.RunAll("screen-length disable", "display nat server")
+		if err != nil {
+			return err
+		}
+		output = outputs[1]
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("执行命令失败: %v", err)
+		return nil, err
 	}
 
 	fmt.Printf("命令执行成功，输出长度: %d 字节\n", len(output))
-	
-	return c.parseNATOutput(string(output))
+
+	return parseEntries(output, c.expiryHour, c.expiryMin, c.location), nil
+}
+
+// CreateEntry 创建NAT映射条目
+func (c *H3CClient) CreateEntry(ctx context.Context, entry *nat.NATEntry) error {
+	fmt.Printf("正在创建NAT条目: %s -> %s (%s)\n", entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+
+	if err := c.checkDescription(entry.Description); err != nil {
+		return fmt.Errorf("创建NAT条目失败: %w", err)
+	}
+
+	cmds := createCommands(entry)
+	fmt.Printf("执行创建命令: %s\n", strings.Join(cmds, " -> "))
+
+	return c.runConfigCommands(ctx, cmds, "创建NAT条目失败")
 }
 
 // DeleteEntry 删除NAT映射条目
-func (c *H3CClient) DeleteEntry(entry *nat.NATEntry) error {
+func (c *H3CClient) DeleteEntry(ctx context.Context, entry *nat.NATEntry) error {
 	fmt.Printf("正在删除NAT条目: %s -> %s (%s)\n", entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
-	
-	conn, err := c.connect()
-	if err != nil {
-		return fmt.Errorf("连接路由器失败: %v", err)
+
+	// 构建删除命令 - H3C路由器的正确格式
+	cmds := deleteCommands(entry)
+	fmt.Printf("执行删除命令: %s\n", strings.Join(cmds, " -> "))
+
+	return c.runConfigCommands(ctx, cmds, "删除NAT条目失败")
+}
+
+// RenewEntry 将条目描述中的过期标记改为新日期
+func (c *H3CClient) RenewEntry(ctx context.Context, entry *nat.NATEntry, expiry time.Time) error {
+	renewed := *entry
+	renewed.Description = nat.WithExpiryTag(entry.Description, expiry)
+	if err := c.checkDescription(renewed.Description); err != nil {
+		return fmt.Errorf("续期后的%w", err)
 	}
-	defer conn.Close()
 
-	session, err := conn.NewSession()
-	if err != nil {
-		return fmt.Errorf("创建SSH会话失败: %v", err)
+	fmt.Printf("正在续期NAT条目: %s -> %s (%s), 新描述: %s\n",
+		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, renewed.Description)
+
+	cmds := renewCommands(entry, &renewed)
+	fmt.Printf("执行续期命令: %s\n", strings.Join(cmds, " -> "))
+
+	if c.dryRun {
+		printPlan(c.host, cmds)
+		return nil
 	}
-	defer session.Close()
 
-	// 构建删除命令 - H3C路由器的正确格式
-	protocol := strings.ToLower(entry.Protocol)
-	deleteCmd := fmt.Sprintf("system-view\ninterface %s\nundo nat server protocol %s global %s %d\n",
-		entry.Interface, protocol, entry.GlobalIP, entry.GlobalPort)
+	return c.conn.WithShell(ctx, c.commandTimeout, func(shell *Shell) error {
+		outputs, err := shell.RunAll(cmds...)
+		if err == nil {
+			fmt.Println("命令执行成功")
+			return nil
+		}
 
-	fmt.Printf("执行删除命令: %s\n", strings.ReplaceAll(deleteCmd, "\n", " -> "))
+		// 原配置已删除但新配置失败时，恢复原配置，避免映射丢失
+		if len(outputs) == len(cmds)-1 {
+			restore := natServerCommand(entry)
+			fmt.Printf("新配置失败，恢复原配置: %s\n", restore)
+			if _, restoreErr := shell.Run(restore); restoreErr != nil {
+				return fmt.Errorf("续期NAT条目失败且恢复原配置失败: %w (恢复错误: %v)", err, restoreErr)
+			}
+		}
+		return fmt.Errorf("续期NAT条目失败: %w", err)
+	})
+}
 
-	// 执行删除命令
-	output, err := session.Output(deleteCmd)
+// BackupEntry 从接口的当前配置中取出条目对应的 nat server 配置行
+func (c *H3CClient) BackupEntry(ctx context.Context, entry *nat.NATEntry) (string, error) {
+	var config string
+	err := c.conn.WithShell(ctx, c.commandTimeout, func(shell *Shell) error {
+		outputs, err := shell.RunAll("screen-length disable", "display current-configuration interface "+entry.Interface)
+		if err != nil {
+			return err
+		}
+		config = outputs[1]
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("删除NAT条目失败: %v, 输出: %s", err, string(output))
+		return "", fmt.Errorf("读取接口 %s 配置失败: %w", entry.Interface, err)
+	}
+
+	line, ok := findConfigLine(config, entry)
+	if !ok {
+		return "", fmt.Errorf("接口 %s 的配置中没有 %s 对应的配置行: %w",
+			entry.Interface, entry.GetGlobalAddress(), nat.ErrEntryNotFound)
+	}
+	return line, nil
+}
+
+// RestoreEntry 在接口上重新应用备份的 nat server 配置行
+func (c *H3CClient) RestoreEntry(ctx context.Context, interfaceName, configLine string) error {
+	if !strings.HasPrefix(configLine, "nat server ") {
+		return fmt.Errorf("不是 nat server 配置行: %s", configLine)
+	}
+	if _, err := c.conn.codec.Encode(configLine); err != nil {
+		return fmt.Errorf("恢复NAT条目失败: %w", err)
 	}
 
-	fmt.Printf("删除命令执行成功，输出: %s\n", string(output))
-	return nil
+	cmds := restoreCommands(interfaceName, configLine)
+	fmt.Printf("执行恢复命令: %s\n", strings.Join(cmds, " -> "))
+
+	return c.runConfigCommands(ctx, cmds, "恢复NAT条目失败")
 }
 
-// connect 建立SSH连接
-func (c *H3CClient) connect() (*ssh.Client, error) {
-	config := &ssh.ClientConfig{
-		User: c.username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(c.password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
+// SaveConfig 保存当前配置，save force 不会出现确认提示
+func (c *H3CClient) SaveConfig(ctx context.Context) error {
+	fmt.Printf("正在保存路由器 %s 配置...\n", c.host)
+	return c.runConfigCommands(ctx, []string{"save force"}, "保存配置失败")
+}
+
+// runConfigCommands 在交互式shell中依次执行配置命令，任一命令出错即停止
+func (c *H3CClient) runConfigCommands(ctx context.Context, cmds []string, failure string) error {
+	if c.dryRun {
+		printPlan(c.host, cmds)
+		return nil
 	}
 
-	conn, err := ssh.Dial("tcp", c.host+":22", config)
+	return c.conn.WithShell(ctx, c.commandTimeout, func(shell *Shell) error {
+		outputs, err := shell.RunAll(cmds...)
+		for i, output := range outputs {
+			if output != "" {
+				fmt.Printf("[%s] 输出: %s\n", cmds[i], output)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", failure, err)
+		}
+
+		fmt.Println("命令执行成功")
+		return nil
+	})
+}
+
+// checkDescription 按路由器编码检查描述长度，编码尚未识别时拒绝非ASCII描述
+func (c *H3CClient) checkDescription(description string) error {
+	data, err := c.conn.codec.Encode(description)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("描述 %q 无法按路由器编码发送: %w", description, err)
 	}
+	return nat.ValidateDescriptionLength(description, len(data))
+}
 
-	return conn, nil
+// printPlan 演练模式下打印将要发送的命令
+func printPlan(host string, cmds []string) {
+	fmt.Printf("[dry-run] 路由器 %s 将执行以下命令（未执行）:\n", host)
+	for _, cmd := range cmds {
+		fmt.Printf("[dry-run]   %s\n", cmd)
+	}
 }
 
-// parseNATOutput 解析NAT命令输出
-func (c *H3CClient) parseNATOutput(output string) ([]*nat.NATEntry, error) {
+// parseEntries 解析NAT命令输出，并按配置的过期时间和时区解析过期日期
+func parseEntries(output string, expiryHour, expiryMin int, loc *time.Location) []*nat.NATEntry {
+	result := ParseNATServerOutput(output)
+
+	for _, line := range result.Unparsed {
+		fmt.Printf("无法解析的输出行 %d: %q (%s)\n", line.Number, strings.TrimSpace(line.Text), line.Reason)
+	}
+
 	var entries []*nat.NATEntry
-	
-	// 按行分割输出
-	lines := strings.Split(output, "\n")
-	
-	var currentEntry *nat.NATEntry
-	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		
-		// 匹配接口行
-		if strings.HasPrefix(line, "Interface:") {
-			if currentEntry != nil {
-				// 使用配置的过期时间解析
-				currentEntry.ParseExpiryDateWithTime(c.expiryHour, c.expiryMin)
-				entries = append(entries, currentEntry)
-			}
-			
-			currentEntry = &nat.NATEntry{}
-			currentEntry.Interface = strings.TrimSpace(strings.TrimPrefix(line, "Interface:"))
-		}
-		
-		if currentEntry == nil {
+	for _, entry := range result.Entries {
+		// 缺少外网地址的条目无法生成删除命令，跳过以免误操作
+		if entry.GlobalIP == "" && entry.GlobalInterface == "" {
+			fmt.Printf("跳过缺少外网地址的条目: 接口 %s, 描述 %q\n", entry.Interface, entry.Description)
 			continue
 		}
-		
-		// 匹配协议行
-		if strings.HasPrefix(line, "Protocol:") {
-			protocolStr := strings.TrimSpace(strings.TrimPrefix(line, "Protocol:"))
-			if strings.Contains(protocolStr, "TCP") {
-				currentEntry.Protocol = "TCP"
-			} else if strings.Contains(protocolStr, "UDP") {
-				currentEntry.Protocol = "UDP"
-			}
-		}
-		
-		// 匹配全局IP/端口行
-		if strings.HasPrefix(line, "Global IP/port:") {
-			globalAddr := strings.TrimSpace(strings.TrimPrefix(line, "Global IP/port:"))
-			if err := c.parseAddress(globalAddr, &currentEntry.GlobalIP, &currentEntry.GlobalPort); err != nil {
-				continue
-			}
-		}
-		
-		// 匹配本地IP/端口行
-		if strings.HasPrefix(line, "Local IP/port") {
-			localAddr := strings.TrimSpace(strings.Split(line, ":")[1])
-			if err := c.parseAddress(localAddr, &currentEntry.LocalIP, &currentEntry.LocalPort); err != nil {
-				continue
-			}
-		}
-		
-		// 匹配描述行
-		if strings.HasPrefix(line, "Description") {
-			currentEntry.Description = strings.TrimSpace(strings.Split(line, ":")[1])
-		}
-		
-		// 匹配状态行
-		if strings.HasPrefix(line, "Config status") {
-			currentEntry.Status = strings.TrimSpace(strings.Split(line, ":")[1])
+
+		// 解析描述中的标记，过期时间使用配置的时分；标记无效的条目保留，由上层提醒修正
+		if err := entry.ParseDescription(expiryHour, expiryMin, loc); err != nil {
+			fmt.Printf("条目 %s 的%v\n", entry.GetGlobalAddress(), err)
 		}
+		entries = append(entries, entry)
 	}
-	
-	// 处理最后一个条目
-	if currentEntry != nil {
-		currentEntry.ParseExpiryDateWithTime(c.expiryHour, c.expiryMin)
-		entries = append(entries, currentEntry)
-	}
-	
-	return entries, nil
-}
-
-// parseAddress 解析IP地址和端口
-func (c *H3CClient) parseAddress(addr string, ip *string, port *int) error {
-	// 匹配 IP/端口 格式
-	re := regexp.MustCompile(`(\d+\.\d+\.\d+\.\d+)/(\d+)`)
-	matches := re.FindStringSubmatch(addr)
-	
-	if len(matches) != 3 {
-		return fmt.Errorf("无效的地址格式: %s", addr)
-	}
-	
-	*ip = matches[1]
-	
-	portNum, err := strconv.Atoi(matches[2])
-	if err != nil {
-		return fmt.Errorf("无效的端口号: %s", matches[2])
-	}
-	
-	*port = portNum
-	return nil
-}
\ No newline at end of file
+
+	return entries
+}
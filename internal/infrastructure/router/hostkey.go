@@ -0,0 +1,143 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy 路由器主机密钥校验策略
+type HostKeyPolicy struct {
+	KnownHostsFile string // known_hosts文件路径
+	Fingerprint    string // 固定指纹，配置后不再读取known_hosts
+	AcceptNew      bool   // 首次连接时信任并记录未知主机密钥
+}
+
+// HostKeyError 路由器的主机密钥未被信任。可能存在中间人攻击，连接时不再重试
+type HostKeyError struct {
+	Hostname    string
+	Fingerprint string // 路由器提供的主机密钥指纹
+	Changed     bool   // 与已记录或配置的密钥不一致，为false时是未知主机
+	message     string
+}
+
+func (e *HostKeyError) Error() string {
+	return e.message
+}
+
+// Callback 构建主机密钥校验回调。校验发生在密钥交换阶段，早于任何认证信息的发送
+func (p *HostKeyPolicy) Callback() (ssh.HostKeyCallback, error) {
+	if p.Fingerprint != "" {
+		return p.fingerprintCallback(), nil
+	}
+	if p.KnownHostsFile == "" {
+		return nil, fmt.Errorf("未配置known_hosts文件或主机密钥指纹")
+	}
+	return p.knownHostsCallback(), nil
+}
+
+// fingerprintCallback 按固定指纹校验
+func (p *HostKeyPolicy) fingerprintCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		actual := ssh.FingerprintSHA256(key)
+		if p.Fingerprint == actual || p.Fingerprint == "MD5:"+ssh.FingerprintLegacyMD5(key) {
+			return nil
+		}
+		return &HostKeyError{
+			Hostname:    hostname,
+			Fingerprint: actual,
+			Changed:     true,
+			message: fmt.Sprintf("主机密钥指纹不匹配 %s: 期望 %s, 实际 %s，请确认路由器是否更换或存在中间人攻击",
+				hostname, p.Fingerprint, actual),
+		}
+	}
+}
+
+// knownHostsCallback 按known_hosts文件校验，未知主机在AcceptNew时写入文件
+func (p *HostKeyPolicy) knownHostsCallback() ssh.HostKeyCallback {
+	var mu sync.Mutex
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := ensureFile(p.KnownHostsFile); err != nil {
+			return err
+		}
+
+		check, err := knownhosts.New(p.KnownHostsFile)
+		if err != nil {
+			return fmt.Errorf("读取known_hosts失败: %v", err)
+		}
+
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		// Want不为空说明该主机已记录过其他密钥
+		if len(keyErr.Want) > 0 {
+			return &HostKeyError{
+				Hostname:    hostname,
+				Fingerprint: fingerprint,
+				Changed:     true,
+				message: fmt.Sprintf("主机密钥已变更 %s (%s %s)，与 %s 第 %d 行记录不一致，请确认路由器是否更换或存在中间人攻击",
+					hostname, key.Type(), fingerprint, keyErr.Want[0].Filename, keyErr.Want[0].Line),
+			}
+		}
+
+		if !p.AcceptNew {
+			return &HostKeyError{
+				Hostname:    hostname,
+				Fingerprint: fingerprint,
+				message: fmt.Sprintf("未知的主机密钥 %s (%s %s)，确认指纹无误后使用 --accept-host-key 信任该主机",
+					hostname, key.Type(), fingerprint),
+			}
+		}
+
+		if err := appendKnownHost(p.KnownHostsFile, hostname, key); err != nil {
+			return err
+		}
+		fmt.Printf("已信任并记录主机密钥 %s (%s %s) 到 %s\n", hostname, key.Type(), fingerprint, p.KnownHostsFile)
+		return nil
+	}
+}
+
+// ensureFile 确保known_hosts文件存在
+func ensureFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("创建known_hosts目录失败: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("创建known_hosts文件失败: %v", err)
+	}
+	return f.Close()
+}
+
+// appendKnownHost 追加一条主机密钥记录
+func appendKnownHost(path, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开known_hosts文件失败: %v", err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("写入known_hosts文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+// dialSimulator 按policy校验主机密钥并用密码登录模拟器，返回建立会话的耗时和错误
+func dialSimulator(t *testing.T, sim *simulator.Server, policy *HostKeyPolicy, password string) (time.Duration, error) {
+	t.Helper()
+	callback, err := policy.Callback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnManager(Hop{Addr: sim.Addr(), Config: &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: callback,
+		Timeout:         5 * time.Second,
+	}}, nil, 0)
+	defer conn.Close()
+
+	start := time.Now()
+	err = conn.WithSession(context.Background(), func(session *ssh.Session) error { return nil })
+	return time.Since(start), err
+}
+
+// assertHostKeyError 检查err为主机密钥错误且没有按退避策略重试
+func assertHostKeyError(t *testing.T, err error, elapsed time.Duration, changed bool, message string) {
+	t.Helper()
+	var hostKeyErr *HostKeyError
+	if !errors.As(err, &hostKeyErr) {
+		t.Fatalf("err = %v, 期望 *HostKeyError", err)
+	}
+	if hostKeyErr.Changed != changed || !strings.Contains(err.Error(), message) {
+		t.Errorf("err = %v, Changed = %v, 期望包含 %q, Changed = %v", err, hostKeyErr.Changed, message, changed)
+	}
+	if elapsed >= defaultBackoff {
+		t.Errorf("主机密钥不受信任时不应重试, 耗时 %v", elapsed)
+	}
+}
+
+func TestKnownHostsPolicy(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+
+	// 未知主机默认拒绝，不写入known_hosts
+	elapsed, err := dialSimulator(t, sim, &HostKeyPolicy{KnownHostsFile: knownHostsFile}, "secret")
+	assertHostKeyError(t, err, elapsed, false, "未知的主机密钥")
+	if data, _ := os.ReadFile(knownHostsFile); len(data) != 0 {
+		t.Errorf("拒绝的主机密钥被写入known_hosts: %s", data)
+	}
+
+	// --accept-host-key 信任并记录主机密钥
+	if _, err := dialSimulator(t, sim, &HostKeyPolicy{KnownHostsFile: knownHostsFile, AcceptNew: true}, "secret"); err != nil {
+		t.Fatalf("AcceptNew 时连接失败: %v", err)
+	}
+	data, err := os.ReadFile(knownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), knownhosts.Normalize(sim.Addr())+" ") {
+		t.Errorf("known_hosts = %q, 期望记录 %s", data, knownhosts.Normalize(sim.Addr()))
+	}
+
+	// 已记录的主机不再需要 --accept-host-key
+	if _, err := dialSimulator(t, sim, &HostKeyPolicy{KnownHostsFile: knownHostsFile}, "secret"); err != nil {
+		t.Fatalf("已记录主机密钥时连接失败: %v", err)
+	}
+
+	// 记录的密钥与路由器提供的不一致时拒绝，AcceptNew 也不会覆盖
+	_, other := newTestKey(t)
+	line := knownhosts.Line([]string{knownhosts.Normalize(sim.Addr())}, other.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	elapsed, err = dialSimulator(t, sim, &HostKeyPolicy{KnownHostsFile: knownHostsFile, AcceptNew: true}, "secret")
+	assertHostKeyError(t, err, elapsed, true, "主机密钥已变更")
+	if data, _ := os.ReadFile(knownHostsFile); string(data) != line+"\n" {
+		t.Errorf("主机密钥变更时known_hosts被修改: %s", data)
+	}
+}
+
+func TestFingerprintPolicy(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	if _, err := dialSimulator(t, sim, &HostKeyPolicy{Fingerprint: sim.Fingerprint()}, "secret"); err != nil {
+		t.Fatalf("指纹匹配时连接失败: %v", err)
+	}
+
+	_, other := newTestKey(t)
+	elapsed, err := dialSimulator(t, sim, &HostKeyPolicy{Fingerprint: ssh.FingerprintSHA256(other.PublicKey())}, "secret")
+	assertHostKeyError(t, err, elapsed, true, "主机密钥指纹不匹配")
+}
+
+func TestDialDoesNotRetryAuthFailure(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	elapsed, err := dialSimulator(t, sim, &HostKeyPolicy{Fingerprint: sim.Fingerprint()}, "wrong")
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("err = %v, 期望 *AuthError", err)
+	}
+	if elapsed >= defaultBackoff {
+		t.Errorf("认证失败时不应重试, 耗时 %v", elapsed)
+	}
+}
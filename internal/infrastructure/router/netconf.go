@@ -0,0 +1,204 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+const (
+	// netconfEOM NETCONF 1.0 的消息结束标记
+	netconfEOM = "]]>]]>"
+	// netconfBaseNS NETCONF基础命名空间
+	netconfBaseNS = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	// comwareDataNS Comware get操作的数据命名空间
+	comwareDataNS = "http://www.h3c.com/netconf/data:1.0"
+	// comwareConfigNS Comware edit-config操作的配置命名空间
+	comwareConfigNS = "http://www.h3c.com/netconf/config:1.0"
+)
+
+// netconfHello 客户端hello，只声明base:1.0，使用结束标记分帧
+const netconfHello = `<?xml version="1.0" encoding="UTF-8"?>
+<hello xmlns="` + netconfBaseNS + `"><capabilities><capability>` + netconfBaseNS + `</capability></capabilities></hello>`
+
+// NetconfSession 基于SSH netconf子系统的NETCONF会话
+type NetconfSession struct {
+	stdin   io.WriteCloser
+	timeout time.Duration
+	msgID   int
+
+	messages chan []byte
+	readErr  error
+}
+
+// rpcReply NETCONF rpc-reply
+type rpcReply struct {
+	Errors []rpcError `xml:"rpc-error"`
+	Data   struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"data"`
+}
+
+// rpcError NETCONF rpc-error
+type rpcError struct {
+	Tag      string `xml:"error-tag"`
+	Severity string `xml:"error-severity"`
+	Message  string `xml:"error-message"`
+}
+
+// netconfErrorKinds rpc-error的error-tag与错误类型的对应关系
+var netconfErrorKinds = map[string]error{
+	"data-missing":            nat.ErrEntryNotFound,
+	"access-denied":           nat.ErrPermissionDenied,
+	"in-use":                  nat.ErrResourceBusy,
+	"lock-denied":             nat.ErrResourceBusy,
+	"invalid-value":           nat.ErrCommandSyntax,
+	"bad-element":             nat.ErrCommandSyntax,
+	"unknown-element":         nat.ErrCommandSyntax,
+	"missing-element":         nat.ErrCommandSyntax,
+	"operation-not-supported": nat.ErrCommandSyntax,
+}
+
+// NewNetconfSession 在会话上启动netconf子系统并交换hello
+func NewNetconfSession(session *ssh.Session, timeout time.Duration) (*NetconfSession, error) {
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("获取输入管道失败: %v", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("获取输出管道失败: %v", err)
+	}
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		return nil, fmt.Errorf("启动netconf子系统失败，请确认已执行 netconf ssh server enable: %v", err)
+	}
+
+	n := &NetconfSession{
+		stdin:    stdin,
+		timeout:  timeout,
+		messages: make(chan []byte, 1),
+	}
+	go n.readLoop(stdout)
+
+	hello, err := n.readMessage()
+	if err != nil {
+		return nil, fmt.Errorf("等待服务端hello失败: %v", err)
+	}
+	if !bytes.Contains(hello, []byte(netconfBaseNS)) {
+		return nil, fmt.Errorf("服务端不支持NETCONF base:1.0")
+	}
+	if err := n.writeMessage(netconfHello); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Call 发送一个rpc并返回<data>中的内容，rpc-error转换为 *CommandError
+func (n *NetconfSession) Call(operation, body string) ([]byte, error) {
+	n.msgID++
+	request := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<rpc message-id="%d" xmlns="%s">%s</rpc>`, n.msgID, netconfBaseNS, body)
+	if err := n.writeMessage(request); err != nil {
+		return nil, err
+	}
+
+	raw, err := n.readMessage()
+	if err != nil {
+		return nil, fmt.Errorf("执行 %s 失败: %v", operation, err)
+	}
+
+	var reply rpcReply
+	if err := xml.Unmarshal(raw, &reply); err != nil {
+		return nil, fmt.Errorf("解析 %s 应答失败: %v", operation, err)
+	}
+	for _, rpcErr := range reply.Errors {
+		if rpcErr.Severity == "warning" {
+			continue
+		}
+		kind, ok := netconfErrorKinds[rpcErr.Tag]
+		if !ok {
+			kind = nat.ErrCommandFailed
+		}
+		return nil, &CommandError{Command: operation, Message: strings.TrimSpace(rpcErr.Tag + ": " + rpcErr.Message), Kind: kind}
+	}
+	return reply.Data.Inner, nil
+}
+
+// Close 发送close-session并关闭输入
+func (n *NetconfSession) Close() error {
+	n.Call("close-session", "<close-session/>")
+	return n.stdin.Close()
+}
+
+// writeMessage 发送一条带结束标记的消息
+func (n *NetconfSession) writeMessage(message string) error {
+	if _, err := io.WriteString(n.stdin, message+netconfEOM); err != nil {
+		return fmt.Errorf("发送NETCONF消息失败: %v", err)
+	}
+	return nil
+}
+
+// readLoop 持续读取并按结束标记拆分消息
+func (n *NetconfSession) readLoop(r io.Reader) {
+	var buf bytes.Buffer
+	chunk := make([]byte, 4096)
+	for {
+		count, err := r.Read(chunk)
+		buf.Write(chunk[:count])
+		for {
+			idx := bytes.Index(buf.Bytes(), []byte(netconfEOM))
+			if idx == -1 {
+				break
+			}
+			message := make([]byte, idx)
+			copy(message, buf.Bytes()[:idx])
+			buf.Next(idx + len(netconfEOM))
+			n.messages <- message
+		}
+		if err != nil {
+			n.readErr = err
+			close(n.messages)
+			return
+		}
+	}
+}
+
+// readMessage 读取下一条完整消息
+func (n *NetconfSession) readMessage() ([]byte, error) {
+	timer := time.NewTimer(n.timeout)
+	defer timer.Stop()
+
+	select {
+	case message, ok := <-n.messages:
+		if !ok {
+			return nil, fmt.Errorf("会话已断开: %v", n.readErr)
+		}
+		return message, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("等待NETCONF应答超时(%v)", n.timeout)
+	}
+}
+
+// WithNetconf 在共享连接上打开NETCONF会话并执行fn
+func (m *ConnManager) WithNetconf(ctx context.Context, timeout time.Duration, fn func(nc *NetconfSession) error) error {
+	return m.WithSession(ctx, func(session *ssh.Session) error {
+		nc, err := NewNetconfSession(session, timeout)
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+
+		return fn(nc)
+	})
+}
@@ -0,0 +1,460 @@
+package router
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/config"
+)
+
+// NetconfClient 通过NETCONF读写 NAT/ServerOnInterfaces 表的H3C客户端，
+// 返回结构化数据，描述为UTF-8，不依赖 display 输出格式
+type NetconfClient struct {
+	host       string
+	expiryHour int
+	expiryMin  int
+	location   *time.Location
+
+	conn           *ConnManager
+	closeAuth      func()
+	dryRun         bool
+	commandTimeout time.Duration
+}
+
+// natServerRow ServerOnInterfaces 表的一行
+type natServerRow struct {
+	XMLName      xml.Name      `xml:"Interface"`
+	Operation    string        `xml:"xc:operation,attr,omitempty"` // edit-config 的操作类型
+	IfIndex      string        `xml:"IfIndex"`
+	ProtocolType string        `xml:"ProtocolType,omitempty"`
+	Global       natGlobalInfo `xml:"GlobalInfo"`
+	Local        *natLocalInfo `xml:"LocalInfo,omitempty"`
+	ACLNumber    string        `xml:"ACLNumber,omitempty"`
+	RuleName     string        `xml:"RuleName,omitempty"`
+	Description  *string       `xml:"Description,omitempty"` // 续期时需要区分未设置和清空
+	Valid        string        `xml:"Valid,omitempty"`
+}
+
+// natGlobalInfo 外网地址信息，与接口和协议一起构成表的索引
+type natGlobalInfo struct {
+	VRF       string `xml:"GlobalVRF,omitempty"`
+	StartIP   string `xml:"GlobalStartIpv4Address,omitempty"`
+	EndIP     string `xml:"GlobalEndIpv4Address,omitempty"`
+	StartPort string `xml:"GlobalStartPortNumber,omitempty"`
+	EndPort   string `xml:"GlobalEndPortNumber,omitempty"`
+	IfIndex   string `xml:"GlobalIfIndex,omitempty"`
+}
+
+// natLocalInfo 内网地址信息
+type natLocalInfo struct {
+	VRF       string `xml:"LocalVRF,omitempty"`
+	StartIP   string `xml:"LocalStartIpv4Address,omitempty"`
+	EndIP     string `xml:"LocalEndIpv4Address,omitempty"`
+	StartPort string `xml:"LocalStartPortNumber,omitempty"`
+	EndPort   string `xml:"LocalEndPortNumber,omitempty"`
+}
+
+// interfaceRow Ifmgr/Interfaces 表的一行，用于接口索引与名称的转换
+type interfaceRow struct {
+	IfIndex string `xml:"IfIndex"`
+	Name    string `xml:"Name"`
+}
+
+// netconfData get操作返回的数据
+type netconfData struct {
+	Interfaces []interfaceRow `xml:"top>Ifmgr>Interfaces>Interface"`
+	Servers    []natServerRow `xml:"top>NAT>ServerOnInterfaces>Interface"`
+}
+
+// protocolNumbers 协议名称与协议号，任意协议为256
+var protocolNumbers = map[string]string{
+	"ICMP": "1",
+	"TCP":  "6",
+	"UDP":  "17",
+	"GRE":  "47",
+	"ANY":  "256",
+}
+
+// getFilter 读取接口名称和NAT服务器表的过滤条件
+const getFilter = `<get><filter type="subtree"><top xmlns="` + comwareDataNS + `">` +
+	`<Ifmgr><Interfaces><Interface><IfIndex/><Name/></Interface></Interfaces></Ifmgr>` +
+	`<NAT><ServerOnInterfaces/></NAT></top></filter></get>`
+
+// NewNetconfClientWithConfig 根据路由器配置创建NETCONF客户端
+func NewNetconfClientWithConfig(routerConfig *config.RouterConfig, opts ClientOptions) (*NetconfClient, error) {
+	conn, closeAuth, err := newConnManager(routerConfig, routerConfig.NetconfAddress(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetconfClient{
+		host:           routerConfig.Host,
+		expiryHour:     routerConfig.ExpiryTime.Hour,
+		expiryMin:      routerConfig.ExpiryTime.Minute,
+		location:       routerConfig.Location(),
+		conn:           conn,
+		closeAuth:      closeAuth,
+		dryRun:         opts.DryRun,
+		commandTimeout: opts.CommandTimeout,
+	}, nil
+}
+
+// Close 关闭客户端持有的SSH连接
+func (c *NetconfClient) Close() {
+	if err := c.conn.Close(); err != nil {
+		fmt.Printf("关闭NETCONF连接失败: %v\n", err)
+	}
+	c.closeAuth()
+}
+
+// GetAllEntries 读取 ServerOnInterfaces 表
+func (c *NetconfClient) GetAllEntries(ctx context.Context) ([]*nat.NATEntry, error) {
+	fmt.Printf("正在通过NETCONF查询路由器 %s...\n", c.host)
+
+	data, err := c.getData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(data.Interfaces))
+	for _, iface := range data.Interfaces {
+		names[iface.IfIndex] = iface.Name
+	}
+
+	var entries []*nat.NATEntry
+	for i := range data.Servers {
+		entry, err := rowToEntry(&data.Servers[i], names)
+		if err != nil {
+			fmt.Printf("跳过无法解析的NAT服务器表项 %d: %v\n", i+1, err)
+			continue
+		}
+		if err := entry.ParseDescription(c.expiryHour, c.expiryMin, c.location); err != nil {
+			fmt.Printf("条目 %s 的%v\n", entry.GetGlobalAddress(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	fmt.Printf("NETCONF查询成功，条目数: %d\n", len(entries))
+	return entries, nil
+}
+
+// CreateEntry 以create操作新增表项
+func (c *NetconfClient) CreateEntry(ctx context.Context, entry *nat.NATEntry) error {
+	fmt.Printf("正在创建NAT条目: %s -> %s (%s)\n", entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+	// NETCONF报文为UTF-8，描述按UTF-8字节数检查
+	if err := nat.ValidateDescriptionLength(entry.Description, len(entry.Description)); err != nil {
+		return fmt.Errorf("创建NAT条目失败: %v", err)
+	}
+	return c.editRow(ctx, entry, "create", true, "创建NAT条目失败")
+}
+
+// DeleteEntry 以remove操作删除表项，只需要索引字段
+func (c *NetconfClient) DeleteEntry(ctx context.Context, entry *nat.NATEntry) error {
+	fmt.Printf("正在删除NAT条目: %s -> %s (%s)\n", entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol)
+	return c.editRow(ctx, entry, "remove", false, "删除NAT条目失败")
+}
+
+// RenewEntry 以merge操作只修改描述，不需要先删除再添加
+func (c *NetconfClient) RenewEntry(ctx context.Context, entry *nat.NATEntry, expiry time.Time) error {
+	renewed := *entry
+	renewed.Description = nat.WithExpiryTag(entry.Description, expiry)
+	if err := nat.ValidateDescriptionLength(renewed.Description, len(renewed.Description)); err != nil {
+		return fmt.Errorf("续期后的%v", err)
+	}
+
+	fmt.Printf("正在续期NAT条目: %s -> %s (%s), 新描述: %s\n",
+		entry.GetGlobalAddress(), entry.GetLocalAddress(), entry.Protocol, renewed.Description)
+
+	indexes, err := c.ifIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	row, err := entryToRow(&renewed, indexes, false)
+	if err != nil {
+		return err
+	}
+	row.Description = &renewed.Description
+
+	return c.editConfig(ctx, row, "merge", "续期NAT条目失败")
+}
+
+// BackupEntry 按表项重建等价的 nat server 配置行，恢复时通过CLI下发
+func (c *NetconfClient) BackupEntry(ctx context.Context, entry *nat.NATEntry) (string, error) {
+	entries, err := c.GetAllEntries(ctx)
+	if err != nil {
+		return "", fmt.Errorf("读取NAT服务器表失败: %w", err)
+	}
+	for _, current := range entries {
+		if current.SameMapping(entry) {
+			return natServerCommand(current), nil
+		}
+	}
+	return "", fmt.Errorf("NAT服务器表中没有 %s 对应的表项: %w", entry.GetGlobalAddress(), nat.ErrEntryNotFound)
+}
+
+// RestoreEntry 通过NETCONF的CLI操作在接口上重新应用备份的配置行
+func (c *NetconfClient) RestoreEntry(ctx context.Context, interfaceName, configLine string) error {
+	if !strings.HasPrefix(configLine, "nat server ") {
+		return fmt.Errorf("不是 nat server 配置行: %s", configLine)
+	}
+
+	cmds := []string{"interface " + interfaceName, configLine, "quit"}
+	body := "<CLI><Configuration>" + xmlEscape(strings.Join(cmds, "\n")) + "</Configuration></CLI>"
+	return c.call(ctx, "CLI", body, "恢复NAT条目失败")
+}
+
+// SaveConfig 保存当前配置
+func (c *NetconfClient) SaveConfig(ctx context.Context) error {
+	fmt.Printf("正在保存路由器 %s 配置...\n", c.host)
+	return c.call(ctx, "save", `<save OverWrite="true"/>`, "保存配置失败")
+}
+
+// editRow 构建表项并执行edit-config
+func (c *NetconfClient) editRow(ctx context.Context, entry *nat.NATEntry, operation string, full bool, failure string) error {
+	indexes, err := c.ifIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	row, err := entryToRow(entry, indexes, full)
+	if err != nil {
+		return err
+	}
+	return c.editConfig(ctx, row, operation, failure)
+}
+
+// editConfig 对单个表项执行edit-config
+func (c *NetconfClient) editConfig(ctx context.Context, row *natServerRow, operation, failure string) error {
+	row.Operation = operation
+	rowXML, err := xml.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("构建NETCONF请求失败: %v", err)
+	}
+
+	body := `<edit-config><target><running/></target><config xmlns:xc="` + netconfBaseNS + `">` +
+		`<top xmlns="` + comwareConfigNS + `"><NAT><ServerOnInterfaces>` + string(rowXML) +
+		`</ServerOnInterfaces></NAT></top></config></edit-config>`
+	return c.call(ctx, "edit-config "+operation, body, failure)
+}
+
+// call 执行一个修改类rpc，演练模式下只打印请求
+func (c *NetconfClient) call(ctx context.Context, operation, body, failure string) error {
+	if c.dryRun {
+		printPlan(c.host, []string{body})
+		return nil
+	}
+
+	return c.conn.WithNetconf(ctx, c.commandTimeout, func(nc *NetconfSession) error {
+		if _, err := nc.Call(operation, body); err != nil {
+			return fmt.Errorf("%s: %w", failure, err)
+		}
+		fmt.Println("NETCONF操作成功")
+		return nil
+	})
+}
+
+// getData 读取接口表和NAT服务器表
+func (c *NetconfClient) getData(ctx context.Context) (*netconfData, error) {
+	var raw []byte
+	err := c.conn.WithNetconf(ctx, c.commandTimeout, func(nc *NetconfSession) error {
+		var err error
+		raw, err = nc.Call("get", getFilter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data netconfData
+	if err := xml.Unmarshal([]byte("<data>"+string(raw)+"</data>"), &data); err != nil {
+		return nil, fmt.Errorf("解析NETCONF数据失败: %v", err)
+	}
+	return &data, nil
+}
+
+// ifIndexes 返回接口名称到索引的映射
+func (c *NetconfClient) ifIndexes(ctx context.Context) (map[string]string, error) {
+	data, err := c.getData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string]string, len(data.Interfaces))
+	for _, iface := range data.Interfaces {
+		indexes[iface.Name] = iface.IfIndex
+	}
+	return indexes, nil
+}
+
+// rowToEntry 将表项转换为NAT条目
+func rowToEntry(row *natServerRow, names map[string]string) (*nat.NATEntry, error) {
+	iface, ok := names[row.IfIndex]
+	if !ok {
+		return nil, fmt.Errorf("未知的接口索引: %s", row.IfIndex)
+	}
+
+	protocol := "ANY"
+	if row.ProtocolType != "" && row.ProtocolType != protocolNumbers["ANY"] {
+		var err error
+		if protocol, err = parseProtocol(row.ProtocolType); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := &nat.NATEntry{
+		Interface: iface,
+		Protocol:  protocol,
+		GlobalIP:  row.Global.StartIP,
+		GlobalVPN: row.Global.VRF,
+		ACL:       row.ACLNumber,
+		RuleName:  row.RuleName,
+		Status:    "Active",
+	}
+	if row.Description != nil {
+		entry.Description = *row.Description
+	}
+	if row.Valid == "false" {
+		entry.Status = "Inactive"
+	}
+	if row.Global.EndIP != row.Global.StartIP {
+		entry.GlobalIPEnd = row.Global.EndIP
+	}
+
+	switch row.Global.IfIndex {
+	case "":
+	case row.IfIndex:
+		entry.GlobalInterface = "current-interface"
+	default:
+		entry.GlobalInterface = names[row.Global.IfIndex]
+	}
+	if entry.GlobalIP == "" && entry.GlobalInterface == "" {
+		return nil, fmt.Errorf("缺少外网地址")
+	}
+
+	var err error
+	if entry.GlobalPort, entry.GlobalPortEnd, err = rowPorts(row.Global.StartPort, row.Global.EndPort); err != nil {
+		return nil, err
+	}
+
+	if row.Local != nil {
+		entry.LocalIP = row.Local.StartIP
+		entry.LocalVPN = row.Local.VRF
+		if row.Local.EndIP != row.Local.StartIP {
+			entry.LocalIPEnd = row.Local.EndIP
+		}
+		if entry.LocalPort, entry.LocalPortEnd, err = rowPorts(row.Local.StartPort, row.Local.EndPort); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// rowPorts 解析起止端口，结束端口与起始端口相同时视为单个端口
+func rowPorts(start, end string) (int, int, error) {
+	if start == "" {
+		return 0, 0, nil
+	}
+	startPort, err := parsePort(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end == "" || end == start {
+		return startPort, 0, nil
+	}
+	endPort, err := parsePort(end)
+	if err != nil {
+		return 0, 0, err
+	}
+	return startPort, endPort, nil
+}
+
+// entryToRow 将NAT条目转换为表项，full为false时只包含索引字段
+func entryToRow(entry *nat.NATEntry, indexes map[string]string, full bool) (*natServerRow, error) {
+	ifIndex, ok := indexes[entry.Interface]
+	if !ok {
+		return nil, fmt.Errorf("路由器上没有接口 %s", entry.Interface)
+	}
+
+	protocol, ok := protocolNumbers[strings.ToUpper(entry.Protocol)]
+	if !ok {
+		if _, err := strconv.Atoi(entry.Protocol); err != nil {
+			return nil, fmt.Errorf("不支持的协议: %s", entry.Protocol)
+		}
+		protocol = entry.Protocol
+	}
+
+	row := &natServerRow{
+		IfIndex:      ifIndex,
+		ProtocolType: protocol,
+		Global: natGlobalInfo{
+			VRF:     entry.GlobalVPN,
+			StartIP: entry.GlobalIP,
+			EndIP:   firstNonEmpty(entry.GlobalIPEnd, entry.GlobalIP),
+		},
+	}
+	switch entry.GlobalInterface {
+	case "":
+	case "current-interface":
+		row.Global.IfIndex = ifIndex
+		row.Global.StartIP, row.Global.EndIP = "", ""
+	default:
+		globalIndex, ok := indexes[entry.GlobalInterface]
+		if !ok {
+			return nil, fmt.Errorf("路由器上没有接口 %s", entry.GlobalInterface)
+		}
+		row.Global.IfIndex = globalIndex
+		row.Global.StartIP, row.Global.EndIP = "", ""
+	}
+	if entry.GlobalPort != 0 {
+		row.Global.StartPort, row.Global.EndPort = portRangeText(entry.GlobalPort, entry.GlobalPortEnd)
+	}
+
+	if !full {
+		return row, nil
+	}
+
+	row.Local = &natLocalInfo{
+		VRF:     entry.LocalVPN,
+		StartIP: entry.LocalIP,
+		EndIP:   firstNonEmpty(entry.LocalIPEnd, entry.LocalIP),
+	}
+	if entry.LocalPort != 0 {
+		row.Local.StartPort, row.Local.EndPort = portRangeText(entry.LocalPort, entry.LocalPortEnd)
+	}
+	row.ACLNumber = entry.ACL
+	row.RuleName = entry.RuleName
+	if entry.Description != "" {
+		description := entry.Description
+		row.Description = &description
+	}
+	return row, nil
+}
+
+// portRangeText 格式化起止端口，单个端口时结束端口与起始端口相同
+func portRangeText(start, end int) (string, string) {
+	if end == 0 {
+		end = start
+	}
+	return strconv.Itoa(start), strconv.Itoa(end)
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// xmlEscape 转义XML文本
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
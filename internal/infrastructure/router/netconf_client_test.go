@@ -0,0 +1,143 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"h3c-nat-manager/internal/domain/nat"
+	"h3c-nat-manager/internal/infrastructure/config"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+func TestNetconfClientAgainstSimulator(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	ctx := context.Background()
+	seed := []string{
+		"nat server protocol tcp global 117.149.14.2 7935 inside 192.168.1.112 7935 description 测试服务 vp=991231",
+		"nat server protocol udp global 117.149.14.2 10000 10010 inside 192.168.1.50 20000 20010 description voice",
+		"nat server protocol tcp global current-interface 8443 inside 192.168.1.90 443",
+	}
+	for _, line := range seed {
+		if err := sim.AddMapping("GigabitEthernet0/0", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	routerConfig := &config.RouterConfig{
+		SSHAuthConfig:      config.SSHAuthConfig{User: "admin", Passwd: "secret"},
+		Name:               "sim",
+		Host:               sim.Host(),
+		Port:               sim.Port(),
+		Backend:            config.BackendNetconf,
+		NetconfPort:        sim.Port(),
+		ExpiryTime:         config.ExpiryTimeConfig{Hour: 21, Minute: 30},
+		HostKeyFingerprint: sim.Fingerprint(),
+	}
+	client, err := NewNetconfClientWithConfig(routerConfig, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// NETCONF读到的条目应与解析 display nat server 得到的一致
+	cliClient, err := NewH3CClientWithConfig(routerConfig, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cliClient.Close()
+
+	entries, err := client.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cliEntries, err := cliClient.GetAllEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(seed) || len(cliEntries) != len(seed) {
+		t.Fatalf("条目数 NETCONF=%d CLI=%d, 期望 %d", len(entries), len(cliEntries), len(seed))
+	}
+	for i, entry := range entries {
+		if !entry.SameMapping(cliEntries[i]) || entry.Description != cliEntries[i].Description {
+			t.Errorf("条目 %d 不一致:\nNETCONF %+v\nCLI     %+v", i, entry, cliEntries[i])
+		}
+	}
+	if entries[0].ExpiryDate == nil || entries[0].ExpiryDate.Format("2006-01-02 15:04") != "2099-12-31 21:30" {
+		t.Errorf("过期时间 = %v, 期望 2099-12-31 21:30", entries[0].ExpiryDate)
+	}
+
+	created := &nat.NATEntry{
+		Interface:   "GigabitEthernet0/1",
+		Protocol:    "TCP",
+		GlobalIP:    "117.149.14.3",
+		GlobalPort:  2222,
+		LocalIP:     "192.168.1.20",
+		LocalPort:   22,
+		Description: "ssh vp=991231",
+	}
+	if err := client.CreateEntry(ctx, created); err != nil {
+		t.Fatalf("CreateEntry() = %v", err)
+	}
+	if !hasLine(sim, "nat server protocol tcp global 117.149.14.3 2222 inside 192.168.1.20 22 description ssh vp=991231") {
+		t.Errorf("创建后NAT表 = %+v", sim.Mappings())
+	}
+	if err := client.CreateEntry(ctx, created); err == nil {
+		t.Error("重复创建应返回错误")
+	}
+
+	if err := client.RenewEntry(ctx, created, time.Date(2100, 1, 31, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatalf("RenewEntry() = %v", err)
+	}
+	if !hasLine(sim, "nat server protocol tcp global 117.149.14.3 2222 inside 192.168.1.20 22 description ssh vp=000131") {
+		t.Errorf("续期后NAT表 = %+v", sim.Mappings())
+	}
+
+	line, err := client.BackupEntry(ctx, entries[1])
+	if err != nil {
+		t.Fatalf("BackupEntry() = %v", err)
+	}
+	if err := client.DeleteEntry(ctx, entries[1]); err != nil {
+		t.Fatalf("DeleteEntry() = %v", err)
+	}
+	if len(sim.Mappings()) != 3 || hasLine(sim, line) {
+		t.Errorf("删除后NAT表 = %+v", sim.Mappings())
+	}
+	if err := client.RestoreEntry(ctx, entries[1].Interface, line); err != nil {
+		t.Fatalf("RestoreEntry() = %v", err)
+	}
+	if !hasLine(sim, "nat server protocol udp global 117.149.14.2 10000 10010 inside 192.168.1.50 20000 20010 description voice") {
+		t.Errorf("恢复后NAT表 = %+v", sim.Mappings())
+	}
+
+	if err := client.SaveConfig(ctx); err != nil {
+		t.Fatalf("SaveConfig() = %v", err)
+	}
+	if got := sim.SaveCount(); got != 1 {
+		t.Errorf("保存次数 = %d, 期望 1", got)
+	}
+
+	sim.FailCommand("netconf edit-config remove", "The system is busy, please try again later.")
+	err = client.DeleteEntry(ctx, entries[0])
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || !errors.Is(err, nat.ErrCommandFailed) {
+		t.Errorf("DeleteEntry() = %v, 期望命令执行失败", err)
+	}
+}
+
+// hasLine 判断模拟器的NAT表中是否有该配置行
+func hasLine(sim *simulator.Server, line string) bool {
+	for _, m := range sim.Mappings() {
+		if strings.TrimSpace(m.Line) == line {
+			return true
+		}
+	}
+	return false
+}
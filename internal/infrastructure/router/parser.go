@@ -0,0 +1,219 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+// UnparsedLine 无法识别的输出行
+type UnparsedLine struct {
+	Number int    // 行号，从1开始
+	Text   string // 原始内容
+	Reason string // 无法解析的原因
+}
+
+// ParseResult display nat server 输出的解析结果
+type ParseResult struct {
+	Entries  []*nat.NATEntry
+	Unparsed []UnparsedLine
+}
+
+var (
+	// protocolPattern 匹配 "6(TCP)"、"17"、"any" 等协议写法
+	protocolPattern = regexp.MustCompile(`^(\d+)?\s*(?:\((\w+)\))?$`)
+	// totalPattern 匹配条目总数行
+	totalPattern = regexp.MustCompile(`^Totally \d+ internal servers?\.?$`)
+	// annotationPattern 匹配地址后的括号注释，如 (current-interface)
+	annotationPattern = regexp.MustCompile(`\(([^)]*)\)`)
+)
+
+// protocolNames 常见协议号与名称
+var protocolNames = map[string]string{
+	"1":  "ICMP",
+	"6":  "TCP",
+	"17": "UDP",
+	"47": "GRE",
+}
+
+// ignoredKeys 已知但不需要记录的字段
+var ignoredKeys = map[string]bool{
+	"NAT counting":   true,
+	"Failure reason": true,
+}
+
+// ParseNATServerOutput 解析Comware V7 display nat server 的输出，
+// 无法识别的行记录在 Unparsed 中而不是直接丢弃
+func ParseNATServerOutput(output string) *ParseResult {
+	result := &ParseResult{}
+	var current *nat.NATEntry
+
+	unparsed := func(number int, text, reason string) {
+		result.Unparsed = append(result.Unparsed, UnparsedLine{Number: number, Text: text, Reason: reason})
+	}
+
+	for i, raw := range strings.Split(output, "\n") {
+		number := i + 1
+		line := strings.TrimSpace(strings.TrimRight(raw, "\r"))
+
+		if line == "" || line == "Server in private network information:" || totalPattern.MatchString(line) {
+			continue
+		}
+
+		// 只按第一个冒号拆分，值中可以包含冒号
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			unparsed(number, raw, "缺少字段分隔符")
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if key == "Interface" {
+			current = &nat.NATEntry{Interface: value}
+			result.Entries = append(result.Entries, current)
+			continue
+		}
+
+		if current == nil {
+			unparsed(number, raw, "出现在第一个Interface行之前")
+			continue
+		}
+
+		if err := applyField(current, key, value); err != nil {
+			unparsed(number, raw, err.Error())
+		}
+	}
+
+	return result
+}
+
+// applyField 将一个字段写入条目
+func applyField(entry *nat.NATEntry, key, value string) error {
+	switch key {
+	case "Protocol":
+		protocol, err := parseProtocol(value)
+		if err != nil {
+			return err
+		}
+		entry.Protocol = protocol
+	case "Global IP/port":
+		return parseGlobalAddress(entry, value)
+	case "Global interface":
+		entry.GlobalInterface = value
+	case "Local IP/port":
+		return parseEndpoint(value, &entry.LocalIP, &entry.LocalIPEnd, &entry.LocalPort, &entry.LocalPortEnd)
+	case "Global VPN":
+		entry.GlobalVPN = value
+	case "Local VPN":
+		entry.LocalVPN = value
+	case "ACL":
+		entry.ACL = value
+	case "Rule name":
+		entry.RuleName = value
+	case "Description":
+		entry.Description = value
+	case "Config status":
+		entry.Status = value
+	default:
+		if !ignoredKeys[key] {
+			return fmt.Errorf("未知字段: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseProtocol 解析协议字段
+func parseProtocol(value string) (string, error) {
+	if strings.EqualFold(value, "any") || strings.Contains(strings.ToLower(value), "(any)") {
+		return "ANY", nil
+	}
+
+	matches := protocolPattern.FindStringSubmatch(value)
+	if matches == nil || (matches[1] == "" && matches[2] == "") {
+		return "", fmt.Errorf("无效的协议: %s", value)
+	}
+	if matches[2] != "" {
+		return strings.ToUpper(matches[2]), nil
+	}
+	if name, ok := protocolNames[matches[1]]; ok {
+		return name, nil
+	}
+	return matches[1], nil
+}
+
+// parseGlobalAddress 解析外网地址，处理 current-interface 等接口地址写法
+func parseGlobalAddress(entry *nat.NATEntry, value string) error {
+	for _, m := range annotationPattern.FindAllStringSubmatch(value, -1) {
+		if strings.Contains(m[1], "current-interface") {
+			entry.GlobalInterface = "current-interface"
+		}
+	}
+	value = strings.TrimSpace(annotationPattern.ReplaceAllString(value, ""))
+
+	if ifName, rest, ok := strings.Cut(value, "current-interface"); ok && strings.TrimSpace(ifName) == "" {
+		entry.GlobalInterface = "current-interface"
+		value = strings.TrimSpace(rest)
+	}
+
+	return parseEndpoint(value, &entry.GlobalIP, &entry.GlobalIPEnd, &entry.GlobalPort, &entry.GlobalPortEnd)
+}
+
+// parseEndpoint 解析 IP[-IP]/端口[-端口] 格式，"---" 表示未知或不适用
+func parseEndpoint(value string, ip, ipEnd *string, port, portEnd *int) error {
+	addrPart, portPart, found := strings.Cut(value, "/")
+	if !found {
+		return fmt.Errorf("无效的地址格式: %s", value)
+	}
+	addrPart = strings.TrimSpace(addrPart)
+	portPart = strings.TrimSpace(portPart)
+
+	if addrPart != "" && addrPart != "---" {
+		start, end, isRange := strings.Cut(addrPart, "-")
+		if net.ParseIP(start) == nil {
+			return fmt.Errorf("无效的IP地址: %s", addrPart)
+		}
+		*ip = start
+		if isRange {
+			if net.ParseIP(end) == nil {
+				return fmt.Errorf("无效的IP地址范围: %s", addrPart)
+			}
+			*ipEnd = end
+		}
+	}
+
+	if portPart == "" || portPart == "---" {
+		return nil
+	}
+
+	start, end, isRange := strings.Cut(portPart, "-")
+	startPort, err := parsePort(start)
+	if err != nil {
+		return err
+	}
+	*port = startPort
+	if isRange {
+		endPort, err := parsePort(end)
+		if err != nil {
+			return err
+		}
+		if endPort < startPort {
+			return fmt.Errorf("无效的端口范围: %s", portPart)
+		}
+		*portEnd = endPort
+	}
+	return nil
+}
+
+// parsePort 解析端口号
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("无效的端口号: %s", value)
+	}
+	return port, nil
+}
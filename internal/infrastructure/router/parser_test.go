@@ -0,0 +1,198 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"h3c-nat-manager/internal/domain/nat"
+)
+
+var update = flag.Bool("update", false, "用当前解析结果更新golden文件")
+
+// goldenEntry golden文件中的条目，只包含解析器填写的字段，领域层新增字段时不需要更新golden文件
+type goldenEntry struct {
+	Interface       string
+	Protocol        string
+	GlobalIP        string
+	GlobalIPEnd     string
+	GlobalPort      int
+	GlobalPortEnd   int
+	GlobalInterface string
+	GlobalVPN       string
+	LocalIP         string
+	LocalIPEnd      string
+	LocalPort       int
+	LocalPortEnd    int
+	LocalVPN        string
+	ACL             string
+	RuleName        string
+	Description     string
+	Status          string
+}
+
+// goldenResult golden文件的内容
+type goldenResult struct {
+	Entries  []goldenEntry
+	Unparsed []UnparsedLine
+}
+
+// newGoldenResult 从解析结果中取出解析器填写的部分
+func newGoldenResult(result *ParseResult) goldenResult {
+	golden := goldenResult{Unparsed: result.Unparsed}
+	for _, e := range result.Entries {
+		golden.Entries = append(golden.Entries, goldenEntry{
+			Interface:       e.Interface,
+			Protocol:        e.Protocol,
+			GlobalIP:        e.GlobalIP,
+			GlobalIPEnd:     e.GlobalIPEnd,
+			GlobalPort:      e.GlobalPort,
+			GlobalPortEnd:   e.GlobalPortEnd,
+			GlobalInterface: e.GlobalInterface,
+			GlobalVPN:       e.GlobalVPN,
+			LocalIP:         e.LocalIP,
+			LocalIPEnd:      e.LocalIPEnd,
+			LocalPort:       e.LocalPort,
+			LocalPortEnd:    e.LocalPortEnd,
+			LocalVPN:        e.LocalVPN,
+			ACL:             e.ACL,
+			RuleName:        e.RuleName,
+			Description:     e.Description,
+			Status:          e.Status,
+		})
+	}
+	return golden
+}
+
+func TestParseNATServerOutputGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/display_nat_server/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("没有找到测试数据")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := json.MarshalIndent(newGoldenResult(ParseNATServerOutput(string(input))), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(file, ".txt") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("读取golden文件失败，可使用 -update 生成: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("解析结果与 %s 不一致:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestParseNATServerOutputCRLF(t *testing.T) {
+	output := "  Interface: GigabitEthernet0/0\r\n    Protocol: 6(TCP)\r\n    Global IP/port: 1.1.1.1/80\r\n" +
+		"    Local IP/port : 10.0.0.1/8080\r\n    Description   : a:b:c\r\n"
+
+	result := ParseNATServerOutput(output)
+	if len(result.Unparsed) != 0 {
+		t.Fatalf("不应有无法解析的行: %+v", result.Unparsed)
+	}
+	if len(result.Entries) != 1 {
+		t.Fatalf("条目数 = %d, 期望 1", len(result.Entries))
+	}
+	if got := result.Entries[0].Description; got != "a:b:c" {
+		t.Errorf("Description = %q, 期望 %q", got, "a:b:c")
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"6(TCP)", "TCP", false},
+		{"17(UDP)", "UDP", false},
+		{"1(ICMP)", "ICMP", false},
+		{"6", "TCP", false},
+		{"47", "GRE", false},
+		{"132", "132", false},
+		{"any", "ANY", false},
+		{"256(Any)", "ANY", false},
+		{"", "", true},
+		{"foo", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseProtocol(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseProtocol(%q) err = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseProtocol(%q) = %q, 期望 %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGlobalClause(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry nat.NATEntry
+		want  string
+	}{
+		{
+			name:  "单端口",
+			entry: nat.NATEntry{Protocol: "TCP", GlobalIP: "1.1.1.1", GlobalPort: 80},
+			want:  "protocol tcp global 1.1.1.1 80",
+		},
+		{
+			name:  "端口范围",
+			entry: nat.NATEntry{Protocol: "UDP", GlobalIP: "1.1.1.1", GlobalPort: 8000, GlobalPortEnd: 8010},
+			want:  "protocol udp global 1.1.1.1 8000 8010",
+		},
+		{
+			name:  "接口地址",
+			entry: nat.NATEntry{Protocol: "TCP", GlobalIP: "58.100.1.9", GlobalInterface: "current-interface", GlobalPort: 443},
+			want:  "protocol tcp global current-interface 443",
+		},
+		{
+			name:  "VPN实例",
+			entry: nat.NATEntry{Protocol: "GRE", GlobalIP: "1.1.1.1", GlobalVPN: "public-vpn"},
+			want:  "protocol gre global 1.1.1.1 vpn-instance public-vpn",
+		},
+		{
+			name:  "任意协议",
+			entry: nat.NATEntry{Protocol: "ANY", GlobalIP: "1.1.1.3"},
+			want:  "global 1.1.1.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := globalClause(&tt.entry); got != tt.want {
+				t.Errorf("globalClause() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
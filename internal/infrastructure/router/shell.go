@@ -0,0 +1,230 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultCommandTimeout 单条命令等待提示符的超时时间
+const defaultCommandTimeout = 30 * time.Second
+
+var (
+	// promptPattern 匹配Comware提示符，用户视图为<hostname>，系统视图为[hostname...]
+	promptPattern = regexp.MustCompile(`^(<[^<>\s]+>|\[[^\[\]\s]+\])$`)
+	// morePattern 匹配分页提示
+	morePattern = regexp.MustCompile(`\s*-+\s*More\s*-+\s*`)
+	// ansiPattern 匹配终端控制序列
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+)
+
+// Shell 基于PTY的交互式命令执行器，逐条发送命令并分别返回输出
+type Shell struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	timeout time.Duration
+	prompt  string
+	codec   *Codec // 命令按此编码发送，输出按此解码
+
+	chunks  chan []byte
+	readErr error
+}
+
+// NewShell 在会话上打开PTY交互式shell，并等待首个提示符；codec为nil时自动识别编码
+func NewShell(session *ssh.Session, timeout time.Duration, codec *Codec) (*Shell, error) {
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	if codec == nil {
+		codec = NewCodec("")
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("vt100", 200, 512, modes); err != nil {
+		return nil, fmt.Errorf("申请PTY失败: %v", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("获取输入管道失败: %v", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("获取输出管道失败: %v", err)
+	}
+
+	if err := session.Shell(); err != nil {
+		return nil, fmt.Errorf("启动交互式shell失败: %v", err)
+	}
+
+	s := &Shell{
+		session: session,
+		stdin:   stdin,
+		timeout: timeout,
+		codec:   codec,
+		chunks:  make(chan []byte, 64),
+	}
+	go s.readLoop(stdout)
+
+	// 登录横幅之后出现提示符才算就绪
+	if _, err := s.readUntilPrompt(); err != nil {
+		return nil, fmt.Errorf("等待登录提示符失败: %v", err)
+	}
+
+	return s, nil
+}
+
+// Prompt 返回最近一次看到的提示符
+func (s *Shell) Prompt() string {
+	return s.prompt
+}
+
+// Run 发送一条命令，返回提示符再次出现之前的输出；
+// 输出中包含Comware错误提示时返回 *CommandError
+func (s *Shell) Run(cmd string) (string, error) {
+	data, err := s.codec.Encode(cmd + "\n")
+	if err != nil {
+		return "", fmt.Errorf("按路由器编码转换命令失败 [%s]: %v", cmd, err)
+	}
+	if _, err := s.stdin.Write(data); err != nil {
+		return "", fmt.Errorf("发送命令失败 [%s]: %v", cmd, err)
+	}
+
+	raw, err := s.readUntilPrompt()
+	if err != nil {
+		return "", fmt.Errorf("执行命令失败 [%s]: %v", cmd, err)
+	}
+
+	output := cleanOutput(s.codec.Decode([]byte(raw)), cmd)
+	return output, classifyOutput(cmd, output)
+}
+
+// RunAll 依次执行多条命令，每条命令的输出单独返回，遇到错误立即停止
+func (s *Shell) RunAll(cmds ...string) ([]string, error) {
+	outputs := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		output, err := s.Run(cmd)
+		outputs = append(outputs, output)
+		if err != nil {
+			return outputs, err
+		}
+	}
+	return outputs, nil
+}
+
+// Close 关闭输入，结束交互式shell
+func (s *Shell) Close() error {
+	return s.stdin.Close()
+}
+
+// readLoop 持续读取shell输出
+func (s *Shell) readLoop(r io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			s.chunks <- chunk
+		}
+		if err != nil {
+			s.readErr = err
+			close(s.chunks)
+			return
+		}
+	}
+}
+
+// readUntilPrompt 读取输出直到末尾出现提示符
+func (s *Shell) readUntilPrompt() (string, error) {
+	var buf bytes.Buffer
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				return buf.String(), fmt.Errorf("会话已断开: %v", s.readErr)
+			}
+			buf.Write(chunk)
+
+			// screen-length disable 之前的输出可能分页，自动翻页
+			if morePattern.Match(lastLine(buf.Bytes())) {
+				if _, err := io.WriteString(s.stdin, " "); err != nil {
+					return buf.String(), fmt.Errorf("发送翻页失败: %v", err)
+				}
+				continue
+			}
+
+			if prompt := matchPrompt(buf.String()); prompt != "" {
+				s.prompt = prompt
+				return buf.String(), nil
+			}
+		case <-timer.C:
+			return buf.String(), fmt.Errorf("等待提示符超时(%v)", s.timeout)
+		}
+	}
+}
+
+// matchPrompt 检查输出最后一行是否为提示符
+func matchPrompt(output string) string {
+	line := strings.TrimSpace(string(lastLine([]byte(ansiPattern.ReplaceAllString(output, "")))))
+	if promptPattern.MatchString(line) {
+		return line
+	}
+	return ""
+}
+
+// lastLine 返回最后一个换行符之后的内容
+func lastLine(data []byte) []byte {
+	if idx := bytes.LastIndexByte(data, '\n'); idx != -1 {
+		return data[idx+1:]
+	}
+	return data
+}
+
+// cleanOutput 去掉回显的命令、分页提示、控制序列和结尾的提示符
+func cleanOutput(raw, cmd string) string {
+	raw = ansiPattern.ReplaceAllString(raw, "")
+	raw = morePattern.ReplaceAllString(raw, "\n")
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	raw = strings.ReplaceAll(raw, "\r", "")
+
+	lines := strings.Split(raw, "\n")
+
+	// 去掉结尾的提示符行
+	if len(lines) > 0 && promptPattern.MatchString(strings.TrimSpace(lines[len(lines)-1])) {
+		lines = lines[:len(lines)-1]
+	}
+
+	// 部分设备即使关闭ECHO也会回显命令
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == strings.TrimSpace(cmd) {
+		lines = lines[1:]
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// WithShell 在共享连接上打开交互式shell并执行fn
+func (m *ConnManager) WithShell(ctx context.Context, timeout time.Duration, fn func(shell *Shell) error) error {
+	return m.WithSession(ctx, func(session *ssh.Session) error {
+		shell, err := NewShell(session, timeout, m.codec)
+		if err != nil {
+			return err
+		}
+		defer shell.Close()
+
+		return fn(shell)
+	})
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"h3c-nat-manager/internal/infrastructure/router/simulator"
+)
+
+func TestShellPagingAgainstSimulator(t *testing.T) {
+	sim, err := simulator.New(simulator.Options{User: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	// 20条映射的输出超过一页，未执行 screen-length disable 时会出现分页提示
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("nat server protocol tcp global 1.1.1.1 %d inside 10.0.0.1 %d description svc-%d vp=991231", 8000+i, 80+i, i)
+		if err := sim.AddMapping("GigabitEthernet0/0", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy := &HostKeyPolicy{Fingerprint: sim.Fingerprint()}
+	callback, err := policy.Callback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnManager(Hop{
+		Addr: sim.Addr(),
+		Config: &ssh.ClientConfig{
+			User:            "admin",
+			Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: callback,
+			Timeout:         5 * time.Second,
+		},
+	}, nil, 1)
+	defer conn.Close()
+
+	var output string
+	err = conn.WithShell(context.Background(), 5*time.Second, func(shell *Shell) error {
+		if got := shell.Prompt(); got != "<H3C>" {
+			t.Errorf("Prompt() = %q, 期望 %q", got, "<H3C>")
+		}
+		output, err = shell.Run("display nat server")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := ParseNATServerOutput(output)
+	if len(result.Unparsed) != 0 {
+		t.Errorf("分页输出中有无法解析的行: %+v", result.Unparsed)
+	}
+	if len(result.Entries) != 20 {
+		t.Errorf("条目数 = %d, 期望 20", len(result.Entries))
+	}
+}
@@ -0,0 +1,267 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pageSize 未执行 screen-length disable 时每页输出的行数
+const pageSize = 24
+
+// 命令视图
+const (
+	viewUser = iota
+	viewSystem
+	viewInterface
+)
+
+// cli 一个交互式shell会话的命令行状态
+type cli struct {
+	server *Server
+	rw     io.ReadWriter
+
+	view          int
+	iface         string
+	screenLength  bool     // 是否分页
+	pending       []string // 分页中尚未输出的行
+	pendingPrompt bool     // 分页输出结束后是否需要提示符
+}
+
+// newCLI 创建会话的命令行状态，默认处于用户视图并启用分页
+func newCLI(server *Server, rw io.ReadWriter) *cli {
+	return &cli{server: server, rw: rw, view: viewUser, screenLength: true}
+}
+
+// run 输出登录横幅后逐行处理命令，直到会话断开或在用户视图执行 quit
+func (c *cli) run() {
+	c.write("\r\n******************************************************************************\r\n" +
+		"* Copyright (c) 2004-2026 New H3C Technologies Co., Ltd. All rights reserved.*\r\n" +
+		"******************************************************************************\r\n\r\n" + c.prompt())
+
+	var line []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := c.rw.Read(buf)
+		for _, b := range buf[:n] {
+			// 分页时任意键继续输出下一页
+			if len(c.pending) > 0 {
+				c.nextPage()
+				continue
+			}
+
+			switch b {
+			case '\r':
+			case '\n':
+				if quit := c.execute(strings.Join(strings.Fields(string(line)), " ")); quit {
+					return
+				}
+				line = line[:0]
+			default:
+				line = append(line, b)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// prompt 当前视图的提示符
+func (c *cli) prompt() string {
+	host := c.server.opts.Hostname
+	switch c.view {
+	case viewSystem:
+		return "[" + host + "]"
+	case viewInterface:
+		return "[" + host + "-" + c.iface + "]"
+	default:
+		return "<" + host + ">"
+	}
+}
+
+// execute 执行一条命令并输出结果，返回是否结束会话
+func (c *cli) execute(cmd string) bool {
+	if cmd == "" {
+		c.write("\r\n" + c.prompt())
+		return false
+	}
+
+	if message, ignored := c.server.record(cmd); message != "" {
+		c.output([]string{message})
+		return false
+	} else if ignored {
+		c.output(nil)
+		return false
+	}
+
+	switch {
+	case cmd == "screen-length disable":
+		c.screenLength = false
+		c.output(nil)
+
+	case cmd == "display nat server":
+		c.output(c.server.displayNATServer())
+
+	case strings.HasPrefix(cmd, "display current-configuration interface "):
+		c.output(c.server.displayInterface(strings.TrimPrefix(cmd, "display current-configuration interface ")))
+
+	case cmd == "system-view" && c.view == viewUser:
+		c.view = viewSystem
+		c.output([]string{"System View: return to User View with Ctrl+Z."})
+
+	case strings.HasPrefix(cmd, "interface ") && c.view != viewUser:
+		c.view = viewInterface
+		c.iface = strings.TrimPrefix(cmd, "interface ")
+		c.output(nil)
+
+	case cmd == "quit":
+		if c.view == viewUser {
+			return true
+		}
+		c.view--
+		c.output(nil)
+
+	case cmd == "return":
+		c.view = viewUser
+		c.output(nil)
+
+	case cmd == "save force" || cmd == "save":
+		c.output(c.server.save())
+
+	case strings.HasPrefix(cmd, "nat server ") && c.view == viewInterface:
+		c.output(c.server.addNATServer(c.iface, cmd))
+
+	case strings.HasPrefix(cmd, "undo nat server ") && c.view == viewInterface:
+		c.output(c.server.removeNATServer(c.iface, strings.TrimPrefix(cmd, "undo nat server ")))
+
+	default:
+		c.output([]string{"                 ^", " % Unrecognized command found at '^' position."})
+	}
+	return false
+}
+
+// output 输出命令结果和提示符，未关闭分页且超过一页时分页输出
+func (c *cli) output(lines []string) {
+	if !c.screenLength || len(lines) <= pageSize {
+		var b strings.Builder
+		b.WriteString("\r\n")
+		for _, line := range lines {
+			b.WriteString(line + "\r\n")
+		}
+		b.WriteString(c.prompt())
+		c.write(b.String())
+		return
+	}
+
+	c.write("\r\n" + strings.Join(lines[:pageSize], "\r\n") + "\r\n  ---- More ----")
+	c.pending = lines[pageSize:]
+}
+
+// nextPage 输出下一页，最后一页之后输出提示符
+func (c *cli) nextPage() {
+	// 与设备一样用控制序列擦除分页提示
+	c.write("\x1b[16D                \x1b[16D")
+
+	if len(c.pending) > pageSize {
+		c.write(strings.Join(c.pending[:pageSize], "\r\n") + "\r\n  ---- More ----")
+		c.pending = c.pending[pageSize:]
+		return
+	}
+
+	c.write(strings.Join(c.pending, "\r\n") + "\r\n" + c.prompt())
+	c.pending = nil
+}
+
+// write 写入会话
+func (c *cli) write(s string) {
+	io.WriteString(c.rw, s)
+}
+
+// displayNATServer 生成 display nat server 的输出
+func (s *Server) displayNATServer() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := []string{
+		"Server in private network information:",
+		fmt.Sprintf("  Totally %d internal servers.", len(s.table)),
+	}
+	for i, entry := range s.table {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, entry.display()...)
+	}
+	return lines
+}
+
+// displayInterface 生成 display current-configuration interface 的输出
+func (s *Server) displayInterface(iface string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := []string{"#", "interface " + iface, " port link-mode route"}
+	for _, entry := range s.table {
+		if entry.iface == iface {
+			lines = append(lines, " "+entry.line)
+		}
+	}
+	return append(lines, "#", "return")
+}
+
+// save 保存配置
+func (s *Server) save() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saves++
+	return []string{
+		"Validating file. Please wait...",
+		"Saved the current configuration to mainboard device successfully.",
+	}
+}
+
+// addNATServer 在接口上添加 nat server 配置
+func (s *Server) addNATServer(iface, cmd string) []string {
+	entry, err := parseNATServer(iface, cmd)
+	if err != nil {
+		return []string{"                 ^", " % Wrong parameter found at '^' position."}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.table {
+		if existing.conflicts(entry) {
+			return []string{" % The global address and port have been used by another internal server."}
+		}
+	}
+	s.table = append(s.table, entry)
+	return nil
+}
+
+// removeNATServer 按协议和外网地址删除接口上的 nat server 配置
+func (s *Server) removeNATServer(iface, key string) []string {
+	target, err := parseGlobalKey(iface, key)
+	if err != nil {
+		return []string{"                 ^", " % Wrong parameter found at '^' position."}
+	}
+	if !s.remove(target) {
+		return []string{" % The NAT server does not exist."}
+	}
+	return nil
+}
+
+// remove 删除与target索引相同的配置，返回是否找到
+func (s *Server) remove(target *natServer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, entry := range s.table {
+		if entry.iface == target.iface && entry.key == target.key {
+			s.table = append(s.table[:i], s.table[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,498 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// netconfEOM NETCONF 1.0 的消息结束标记
+	netconfEOM = "]]>]]>"
+	// netconfBaseNS NETCONF基础命名空间
+	netconfBaseNS = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	// comwareDataNS Comware get操作的数据命名空间
+	comwareDataNS = "http://www.h3c.com/netconf/data:1.0"
+)
+
+// ncRPC 客户端发送的rpc，只解析支持的操作
+type ncRPC struct {
+	MessageID    string        `xml:"message-id,attr"`
+	Get          *struct{}     `xml:"get"`
+	EditConfig   *ncEditConfig `xml:"edit-config"`
+	Save         *struct{}     `xml:"save"`
+	CLI          *ncCLI        `xml:"CLI"`
+	CloseSession *struct{}     `xml:"close-session"`
+}
+
+// ncEditConfig edit-config中 ServerOnInterfaces 表的表项
+type ncEditConfig struct {
+	Rows []ncRow `xml:"config>top>NAT>ServerOnInterfaces>Interface"`
+}
+
+// ncCLI 通过NETCONF执行的命令行配置
+type ncCLI struct {
+	Configuration string `xml:"Configuration"`
+}
+
+// ncRow ServerOnInterfaces 表的一行
+type ncRow struct {
+	XMLName      xml.Name     `xml:"Interface"`
+	Operation    string       `xml:"operation,attr,omitempty"`
+	IfIndex      string       `xml:"IfIndex"`
+	ProtocolType string       `xml:"ProtocolType,omitempty"`
+	Global       ncGlobalInfo `xml:"GlobalInfo"`
+	Local        *ncLocalInfo `xml:"LocalInfo,omitempty"`
+	ACLNumber    string       `xml:"ACLNumber,omitempty"`
+	RuleName     string       `xml:"RuleName,omitempty"`
+	Description  *string      `xml:"Description,omitempty"`
+	Valid        string       `xml:"Valid,omitempty"`
+}
+
+// ncGlobalInfo 外网地址信息
+type ncGlobalInfo struct {
+	VRF       string `xml:"GlobalVRF,omitempty"`
+	StartIP   string `xml:"GlobalStartIpv4Address,omitempty"`
+	EndIP     string `xml:"GlobalEndIpv4Address,omitempty"`
+	StartPort string `xml:"GlobalStartPortNumber,omitempty"`
+	EndPort   string `xml:"GlobalEndPortNumber,omitempty"`
+	IfIndex   string `xml:"GlobalIfIndex,omitempty"`
+}
+
+// ncLocalInfo 内网地址信息
+type ncLocalInfo struct {
+	VRF       string `xml:"LocalVRF,omitempty"`
+	StartIP   string `xml:"LocalStartIpv4Address,omitempty"`
+	EndIP     string `xml:"LocalEndIpv4Address,omitempty"`
+	StartPort string `xml:"LocalStartPortNumber,omitempty"`
+	EndPort   string `xml:"LocalEndPortNumber,omitempty"`
+}
+
+// ncInterface Ifmgr/Interfaces 表的一行
+type ncInterface struct {
+	IfIndex int    `xml:"IfIndex"`
+	Name    string `xml:"Name"`
+}
+
+// ncTop get操作返回的数据
+type ncTop struct {
+	XMLName    xml.Name      `xml:"top"`
+	Xmlns      string        `xml:"xmlns,attr"`
+	Interfaces []ncInterface `xml:"Ifmgr>Interfaces>Interface"`
+	Servers    []ncRow       `xml:"NAT>ServerOnInterfaces>Interface"`
+}
+
+// ncError 返回给客户端的rpc-error
+type ncError struct {
+	tag     string
+	message string
+}
+
+func (e *ncError) Error() string {
+	return e.tag + ": " + e.message
+}
+
+// handleNetconf 处理netconf子系统：交换hello后逐条应答rpc，直到close-session或会话断开
+func (s *Server) handleNetconf(rw io.ReadWriter) {
+	s.mu.Lock()
+	s.sessionID++
+	sessionID := s.sessionID
+	s.mu.Unlock()
+
+	hello := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><hello xmlns="%s"><capabilities>`+
+		`<capability>%s</capability><capability>urn:ietf:params:netconf:capability:writable-running:1.0</capability>`+
+		`</capabilities><session-id>%d</session-id></hello>`, netconfBaseNS, netconfBaseNS, sessionID)
+	if _, err := io.WriteString(rw, hello+netconfEOM); err != nil {
+		return
+	}
+
+	messages := make(chan []byte)
+	go splitMessages(rw, messages)
+
+	// 第一条消息是客户端hello
+	if _, ok := <-messages; !ok {
+		return
+	}
+	for message := range messages {
+		var rpc ncRPC
+		if err := xml.Unmarshal(message, &rpc); err != nil {
+			io.WriteString(rw, rpcReply("", "", &ncError{"malformed-message", err.Error()})+netconfEOM)
+			continue
+		}
+
+		data, err := s.netconfOperation(&rpc)
+		io.WriteString(rw, rpcReply(rpc.MessageID, data, err)+netconfEOM)
+		if rpc.CloseSession != nil {
+			return
+		}
+	}
+}
+
+// splitMessages 按结束标记拆分消息，会话断开时关闭通道
+func splitMessages(r io.Reader, messages chan<- []byte) {
+	defer close(messages)
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		for {
+			idx := bytes.Index(buf.Bytes(), []byte(netconfEOM))
+			if idx == -1 {
+				break
+			}
+			message := make([]byte, idx)
+			copy(message, buf.Bytes()[:idx])
+			buf.Next(idx + len(netconfEOM))
+			messages <- message
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// rpcReply 生成rpc-reply，data为空时返回<ok/>
+func rpcReply(messageID, data string, err error) string {
+	var body string
+	switch e, ok := err.(*ncError); {
+	case ok:
+		body = "<rpc-error><error-type>application</error-type><error-tag>" + xmlEscape(e.tag) +
+			"</error-tag><error-severity>error</error-severity><error-message>" + xmlEscape(e.message) +
+			"</error-message></rpc-error>"
+	case err != nil:
+		body = "<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag>" +
+			"<error-severity>error</error-severity><error-message>" + xmlEscape(err.Error()) + "</error-message></rpc-error>"
+	case data != "":
+		body = "<data>" + data + "</data>"
+	default:
+		body = "<ok/>"
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><rpc-reply message-id="%s" xmlns="%s">%s</rpc-reply>`,
+		xmlEscape(messageID), netconfBaseNS, body)
+}
+
+// netconfOperation 执行一个rpc，返回<data>中的内容
+func (s *Server) netconfOperation(rpc *ncRPC) (string, error) {
+	switch {
+	case rpc.Get != nil:
+		return s.netconfGet()
+
+	case rpc.EditConfig != nil:
+		for _, row := range rpc.EditConfig.Rows {
+			if err := s.netconfEdit(row); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+
+	case rpc.Save != nil:
+		if message, ignored := s.record("netconf save"); message != "" {
+			return "", &ncError{"operation-failed", message}
+		} else if !ignored {
+			s.save()
+		}
+		return "", nil
+
+	case rpc.CLI != nil:
+		return "", s.netconfCLI(rpc.CLI.Configuration)
+
+	case rpc.CloseSession != nil:
+		return "", nil
+
+	default:
+		return "", &ncError{"operation-not-supported", "不支持的操作"}
+	}
+}
+
+// netconfGet 返回接口表和NAT服务器表
+func (s *Server) netconfGet() (string, error) {
+	s.record("netconf get")
+
+	s.mu.Lock()
+	top := ncTop{Xmlns: comwareDataNS}
+	for _, entry := range s.table {
+		top.Servers = append(top.Servers, s.toRow(entry))
+	}
+	for name, index := range s.ifIndexes {
+		top.Interfaces = append(top.Interfaces, ncInterface{IfIndex: index, Name: name})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(top.Interfaces, func(i, j int) bool { return top.Interfaces[i].IfIndex < top.Interfaces[j].IfIndex })
+	data, err := xml.Marshal(top)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// netconfEdit 对一个表项执行create、merge、remove或delete
+func (s *Server) netconfEdit(row ncRow) error {
+	operation := row.Operation
+	if operation == "" {
+		operation = "merge"
+	}
+	if message, ignored := s.record("netconf edit-config " + operation); message != "" {
+		return &ncError{"operation-failed", message}
+	} else if ignored {
+		return nil
+	}
+
+	entry, err := s.fromRow(row)
+	if err != nil {
+		return &ncError{"invalid-value", err.Error()}
+	}
+
+	switch operation {
+	case "create":
+		if row.Local == nil {
+			return &ncError{"missing-element", "缺少 LocalInfo"}
+		}
+		if err := s.add(entry); err != nil {
+			return &ncError{"data-exists", err.Error()}
+		}
+	case "merge":
+		if !s.update(entry, row) {
+			return &ncError{"data-missing", "The NAT server does not exist."}
+		}
+	case "remove":
+		s.remove(entry)
+	case "delete":
+		if !s.remove(entry) {
+			return &ncError{"data-missing", "The NAT server does not exist."}
+		}
+	default:
+		return &ncError{"bad-attribute", "不支持的操作: " + operation}
+	}
+	return nil
+}
+
+// netconfCLI 在系统视图下逐行执行命令，输出中有错误提示时返回错误
+func (s *Server) netconfCLI(configuration string) error {
+	var out bytes.Buffer
+	c := newCLI(s, &out)
+	c.view = viewSystem
+	c.screenLength = false
+
+	for _, line := range strings.Split(configuration, "\n") {
+		c.execute(strings.Join(strings.Fields(line), " "))
+	}
+	for _, line := range strings.Split(out.String(), "\r\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "%") {
+			return &ncError{"operation-failed", strings.TrimSpace(line)}
+		}
+	}
+	return nil
+}
+
+// add 添加配置，与已有配置冲突时返回错误
+func (s *Server) add(entry *natServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.table {
+		if existing.conflicts(entry) {
+			return errors.New("The global address and port have been used by another internal server.")
+		}
+	}
+	s.table = append(s.table, entry)
+	return nil
+}
+
+// update 按索引找到配置并修改row中给出的可选字段，返回是否找到
+func (s *Server) update(target *natServer, row ncRow) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.table {
+		if entry.iface != target.iface || entry.key != target.key {
+			continue
+		}
+		if row.Description != nil {
+			entry.description = *row.Description
+		}
+		if row.ACLNumber != "" {
+			entry.acl = row.ACLNumber
+		}
+		if row.RuleName != "" {
+			entry.rule = row.RuleName
+		}
+		entry.format()
+		return true
+	}
+	return false
+}
+
+// ifIndex 返回接口索引，首次出现的接口分配新的索引，调用方需持有锁
+func (s *Server) ifIndex(name string) string {
+	index, ok := s.ifIndexes[name]
+	if !ok {
+		index = len(s.ifIndexes) + 1
+		s.ifIndexes[name] = index
+	}
+	return strconv.Itoa(index)
+}
+
+// ifName 返回索引对应的接口名称
+func (s *Server) ifName(index string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, i := range s.ifIndexes {
+		if strconv.Itoa(i) == index {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// toRow 将配置转换为表项，调用方需持有锁
+func (s *Server) toRow(entry *natServer) ncRow {
+	row := ncRow{
+		IfIndex:      s.ifIndex(entry.iface),
+		ProtocolType: protocolNumber(entry.protocol),
+		Global: ncGlobalInfo{
+			VRF:     entry.globalVPN,
+			StartIP: entry.globalIP,
+			EndIP:   firstNonEmpty(entry.globalIPEnd, entry.globalIP),
+		},
+		Local: &ncLocalInfo{
+			VRF:     entry.localVPN,
+			StartIP: entry.localIP,
+			EndIP:   firstNonEmpty(entry.localIPEnd, entry.localIP),
+		},
+		ACLNumber: entry.acl,
+		RuleName:  entry.rule,
+		Valid:     "true",
+	}
+	switch {
+	case entry.currentInterface:
+		row.Global.IfIndex = row.IfIndex
+	case entry.globalInterface != "":
+		row.Global.IfIndex = s.ifIndex(entry.globalInterface)
+	}
+	if entry.globalPort != "" {
+		row.Global.StartPort = entry.globalPort
+		row.Global.EndPort = firstNonEmpty(entry.globalPortEnd, entry.globalPort)
+	}
+	if entry.localPort != "" {
+		row.Local.StartPort = entry.localPort
+		row.Local.EndPort = firstNonEmpty(entry.localPortEnd, entry.localPort)
+	}
+	if entry.description != "" {
+		description := entry.description
+		row.Description = &description
+	}
+	return row
+}
+
+// fromRow 将表项转换为配置，没有 LocalInfo 时只包含索引字段
+func (s *Server) fromRow(row ncRow) (*natServer, error) {
+	iface, ok := s.ifName(row.IfIndex)
+	if !ok {
+		return nil, fmt.Errorf("未知的接口索引: %s", row.IfIndex)
+	}
+
+	entry := &natServer{
+		iface:     iface,
+		globalVPN: row.Global.VRF,
+		acl:       row.ACLNumber,
+		rule:      row.RuleName,
+	}
+	if row.Description != nil {
+		entry.description = *row.Description
+	}
+
+	var err error
+	if entry.protocol, err = protocolName(row.ProtocolType); err != nil {
+		return nil, err
+	}
+
+	switch row.Global.IfIndex {
+	case "":
+		if row.Global.StartIP == "" {
+			return nil, fmt.Errorf("缺少外网地址")
+		}
+		entry.globalIP, entry.globalIPEnd = rangeValues(row.Global.StartIP, row.Global.EndIP)
+	case row.IfIndex:
+		entry.currentInterface = true
+	default:
+		if entry.globalInterface, ok = s.ifName(row.Global.IfIndex); !ok {
+			return nil, fmt.Errorf("未知的接口索引: %s", row.Global.IfIndex)
+		}
+	}
+	entry.globalPort, entry.globalPortEnd = rangeValues(row.Global.StartPort, row.Global.EndPort)
+
+	if row.Local != nil {
+		if row.Local.StartIP == "" {
+			return nil, fmt.Errorf("缺少内网地址")
+		}
+		entry.localIP, entry.localIPEnd = rangeValues(row.Local.StartIP, row.Local.EndIP)
+		entry.localPort, entry.localPortEnd = rangeValues(row.Local.StartPort, row.Local.EndPort)
+		entry.localVPN = row.Local.VRF
+	}
+
+	if (entry.protocol == "tcp" || entry.protocol == "udp") && entry.globalPort == "" {
+		return nil, fmt.Errorf("缺少端口")
+	}
+
+	entry.format()
+	return entry, nil
+}
+
+// protocolNumber 协议名称转换为协议号
+func protocolNumber(protocol string) string {
+	if display, ok := protocolNumbers[protocol]; ok {
+		number, _, _ := strings.Cut(display, "(")
+		return number
+	}
+	return protocol
+}
+
+// protocolName 协议号转换为协议名称，任意协议为空
+func protocolName(number string) (string, error) {
+	if number == "" {
+		return "", nil
+	}
+	for name, display := range protocolNumbers {
+		if strings.HasPrefix(display, number+"(") {
+			return name, nil
+		}
+	}
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", fmt.Errorf("无效的协议号: %s", number)
+	}
+	return number, nil
+}
+
+// rangeValues 起止值相同时只保留起始值
+func rangeValues(start, end string) (string, string) {
+	if end == start {
+		return start, ""
+	}
+	return start, end
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// xmlEscape 转义XML文本
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
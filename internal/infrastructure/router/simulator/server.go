@@ -0,0 +1,391 @@
+// Package simulator 本地H3C Comware SSH模拟器，基于内存NAT表实现端到端测试所需的命令子集，
+// 同一端口同时提供交互式shell和netconf子系统
+package simulator
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Options 模拟器选项
+type Options struct {
+	Hostname string // 提示符中的设备名，默认 H3C
+	User     string // 登录用户名
+	Password string // 登录密码
+
+	AuthorizedKeys []ssh.PublicKey // 允许登录的公钥，为空时只接受密码
+
+	Interfaces []string // 设备上的接口，NETCONF按索引引用，默认 GigabitEthernet0/0 和 GigabitEthernet0/1
+
+	AllowForwarding bool // 接受 direct-tcpip 端口转发，作为跳板机使用
+}
+
+// Mapping 内存NAT表中的一条配置
+type Mapping struct {
+	Interface string // 配置所在接口
+	Line      string // nat server 配置行
+}
+
+// Server 模拟Comware设备的SSH服务
+type Server struct {
+	opts     Options
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+	listener net.Listener
+
+	mu       sync.Mutex
+	table    []*natServer
+	commands []string          // 收到的全部命令，按顺序记录
+	failures map[string]string // 命令前缀 -> 返回的错误信息
+	ignored  []string          // 这些前缀的命令返回成功但不生效
+	saves    int
+	logins   int      // 登录成功的SSH连接数
+	forwards []string // 经本机转发的目标地址，按顺序记录
+	conns    map[net.Conn]struct{}
+
+	ifIndexes map[string]int // 接口名称 -> NETCONF接口索引
+	sessionID int
+
+	wg sync.WaitGroup
+}
+
+// New 创建并启动模拟器，监听127.0.0.1的随机端口
+func New(opts Options) (*Server, error) {
+	if opts.Hostname == "" {
+		opts.Hostname = "H3C"
+	}
+	if len(opts.Interfaces) == 0 {
+		opts.Interfaces = []string{"GigabitEthernet0/0", "GigabitEthernet0/1"}
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成主机密钥失败: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("生成主机密钥失败: %v", err)
+	}
+
+	s := &Server{
+		opts:      opts,
+		hostKey:   signer.PublicKey(),
+		failures:  make(map[string]string),
+		conns:     make(map[net.Conn]struct{}),
+		ifIndexes: make(map[string]int),
+	}
+	for _, name := range opts.Interfaces {
+		s.ifIndex(name)
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == opts.User && string(password) == opts.Password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("认证失败")
+		},
+	}
+	if len(opts.AuthorizedKeys) > 0 {
+		s.config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authorized := range opts.AuthorizedKeys {
+				if conn.User() == opts.User && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("公钥未授权")
+		}
+	}
+	s.config.AddHostKey(signer)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("监听失败: %v", err)
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Host 返回监听的主机
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port 返回监听的端口
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Fingerprint 返回主机密钥的SHA256指纹
+func (s *Server) Fingerprint() string {
+	return ssh.FingerprintSHA256(s.hostKey)
+}
+
+// AddMapping 直接向NAT表写入一条配置，用于准备测试数据
+func (s *Server) AddMapping(iface, line string) error {
+	entry, err := parseNATServer(iface, line)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.table {
+		if existing.conflicts(entry) {
+			return fmt.Errorf("外网地址端口冲突: %s", existing.line)
+		}
+	}
+	s.table = append(s.table, entry)
+	return nil
+}
+
+// Mappings 返回当前NAT表
+func (s *Server) Mappings() []Mapping {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mappings := make([]Mapping, 0, len(s.table))
+	for _, entry := range s.table {
+		mappings = append(mappings, Mapping{Interface: entry.iface, Line: entry.line})
+	}
+	return mappings
+}
+
+// Commands 返回收到的全部命令
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// SaveCount 返回执行保存的次数
+func (s *Server) SaveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+// FailCommand 以prefix开头的命令返回message作为错误提示
+func (s *Server) FailCommand(prefix, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[prefix] = message
+}
+
+// IgnoreCommand 以prefix开头的命令返回成功但不生效，模拟配置未落地
+func (s *Server) IgnoreCommand(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignored = append(s.ignored, prefix)
+}
+
+// Logins 返回登录成功的SSH连接数，用于检查连接复用和重连
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Forwards 返回经本机转发的目标地址
+func (s *Server) Forwards() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwards...)
+}
+
+// DropConnections 断开当前所有连接，模拟路由器空闲超时或重启，之后仍接受新连接
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Close 停止监听，断开所有连接并等待处理结束
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// serve 接受连接
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+// handleConn 完成SSH握手并处理会话通道
+func (s *Server) handleConn(conn net.Conn) {
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	s.mu.Lock()
+	s.logins++
+	s.mu.Unlock()
+	go ssh.DiscardRequests(requests)
+
+	var wg sync.WaitGroup
+	for newChannel := range channels {
+		if newChannel.ChannelType() == "direct-tcpip" && s.opts.AllowForwarding {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.forward(newChannel)
+			}()
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "只支持session")
+			continue
+		}
+		channel, chanRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleSession(channel, chanRequests)
+		}()
+	}
+	wg.Wait()
+}
+
+// forward 处理 direct-tcpip 通道，连接目标地址并双向转发
+func (s *Server) forward(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "无效的转发请求")
+		return
+	}
+	addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer target.Close()
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	s.mu.Lock()
+	s.forwards = append(s.forwards, addr)
+	s.mu.Unlock()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(target, channel)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(channel, target)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// handleSession 处理会话请求，支持PTY交互式shell和netconf子系统
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req", "env", "window-change":
+			req.Reply(true, nil)
+		case "shell":
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			newCLI(s, channel).run()
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "netconf" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			s.handleNetconf(channel)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// record 记录命令，返回注入的错误信息或是否忽略
+func (s *Server) record(cmd string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, cmd)
+	for prefix, message := range s.failures {
+		if strings.HasPrefix(cmd, prefix) {
+			return message, false
+		}
+	}
+	for _, prefix := range s.ignored {
+		if strings.HasPrefix(cmd, prefix) {
+			return "", true
+		}
+	}
+	return "", false
+}
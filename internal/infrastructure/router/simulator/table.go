@@ -0,0 +1,357 @@
+package simulator
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// natServer 内存NAT表中的一条 nat server 配置
+type natServer struct {
+	iface string // 配置所在接口
+	line  string // 规范化的配置行
+	key   string // 规范化的协议和外网地址部分，undo 命令按此匹配
+
+	protocol         string // tcp/udp/gre 等，为空表示任意协议
+	globalIP         string
+	globalIPEnd      string
+	currentInterface bool
+	globalInterface  string
+	globalPort       string
+	globalPortEnd    string
+	globalVPN        string
+
+	localIP      string
+	localIPEnd   string
+	localPort    string
+	localPortEnd string
+	localVPN     string
+
+	acl         string
+	rule        string
+	description string
+}
+
+// protocolNumbers display 输出中的协议号
+var protocolNumbers = map[string]string{
+	"icmp": "1(ICMP)",
+	"tcp":  "6(TCP)",
+	"udp":  "17(UDP)",
+	"gre":  "47(GRE)",
+	"":     "256(Any)",
+}
+
+// parseNATServer 解析 nat server 配置命令
+func parseNATServer(iface, line string) (*natServer, error) {
+	tokens := strings.Fields(line)
+	if len(tokens) < 2 || tokens[0] != "nat" || tokens[1] != "server" {
+		return nil, fmt.Errorf("不是 nat server 命令")
+	}
+	tokens = tokens[2:]
+
+	inside := indexOf(tokens, "inside")
+	if inside == -1 {
+		return nil, fmt.Errorf("缺少 inside")
+	}
+
+	s, err := parseGlobalKey(iface, strings.Join(tokens[:inside], " "))
+	if err != nil {
+		return nil, err
+	}
+
+	rest := tokens[inside+1:]
+	end := len(rest)
+	for i, token := range rest {
+		if token == "acl" || token == "rule" || token == "description" {
+			end = i
+			break
+		}
+	}
+	if err := s.parseLocal(rest[:end]); err != nil {
+		return nil, err
+	}
+
+	options := rest[end:]
+	for len(options) > 0 {
+		switch options[0] {
+		case "description":
+			// 描述是行尾剩余的全部内容
+			s.description = strings.Join(options[1:], " ")
+			options = nil
+		case "acl", "rule":
+			if len(options) < 2 {
+				return nil, fmt.Errorf("%s 缺少参数", options[0])
+			}
+			if options[0] == "acl" {
+				s.acl = options[1]
+			} else {
+				s.rule = options[1]
+			}
+			options = options[2:]
+		default:
+			return nil, fmt.Errorf("未知参数: %s", options[0])
+		}
+	}
+
+	s.format()
+	return s, nil
+}
+
+// parseGlobalKey 解析 nat server 命令中协议和外网地址部分，即 undo 命令的参数
+func parseGlobalKey(iface, text string) (*natServer, error) {
+	global := strings.Fields(text)
+	s := &natServer{iface: iface}
+
+	if len(global) >= 2 && global[0] == "protocol" {
+		s.protocol = global[1]
+		global = global[2:]
+	}
+	if len(global) == 0 || global[0] != "global" {
+		return nil, fmt.Errorf("缺少 global")
+	}
+	if err := s.parseGlobal(global[1:]); err != nil {
+		return nil, err
+	}
+
+	s.format()
+	return s, nil
+}
+
+// format 按字段生成规范的配置行和索引，与输入的空格、写法无关
+func (s *natServer) format() {
+	var key []string
+	if s.protocol != "" {
+		key = append(key, "protocol", s.protocol)
+	}
+	key = append(key, "global")
+	switch {
+	case s.currentInterface:
+		key = append(key, "current-interface")
+	case s.globalInterface != "":
+		key = append(key, "interface", s.globalInterface)
+	default:
+		key = appendNonEmpty(key, s.globalIP, s.globalIPEnd)
+	}
+	key = appendNonEmpty(key, s.globalPort, s.globalPortEnd)
+	if s.globalVPN != "" {
+		key = append(key, "vpn-instance", s.globalVPN)
+	}
+	s.key = strings.Join(key, " ")
+
+	line := []string{"nat server", s.key, "inside"}
+	line = appendNonEmpty(line, s.localIP, s.localIPEnd, s.localPort, s.localPortEnd)
+	if s.localVPN != "" {
+		line = append(line, "vpn-instance", s.localVPN)
+	}
+	if s.acl != "" {
+		line = append(line, "acl", s.acl)
+	}
+	if s.rule != "" {
+		line = append(line, "rule", s.rule)
+	}
+	if s.description != "" {
+		line = append(line, "description", s.description)
+	}
+	s.line = strings.Join(line, " ")
+}
+
+// appendNonEmpty 追加非空的值
+func appendNonEmpty(tokens []string, values ...string) []string {
+	for _, v := range values {
+		if v != "" {
+			tokens = append(tokens, v)
+		}
+	}
+	return tokens
+}
+
+// parseGlobal 解析外网地址部分
+func (s *natServer) parseGlobal(tokens []string) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("缺少外网地址")
+	}
+
+	switch tokens[0] {
+	case "current-interface":
+		s.currentInterface = true
+		tokens = tokens[1:]
+	case "interface":
+		if len(tokens) < 2 {
+			return fmt.Errorf("缺少外网接口")
+		}
+		s.globalInterface = tokens[1]
+		tokens = tokens[2:]
+	default:
+		var err error
+		s.globalIP, s.globalIPEnd, tokens, err = parseAddress(tokens)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	s.globalPort, s.globalPortEnd, s.globalVPN, err = s.parsePortsAndVPN(tokens)
+	return err
+}
+
+// parseLocal 解析内网地址部分
+func (s *natServer) parseLocal(tokens []string) error {
+	var err error
+	s.localIP, s.localIPEnd, tokens, err = parseAddress(tokens)
+	if err != nil {
+		return err
+	}
+	s.localPort, s.localPortEnd, s.localVPN, err = s.parsePortsAndVPN(tokens)
+	return err
+}
+
+// parsePortsAndVPN 解析端口和VPN实例，只有TCP和UDP带端口
+func (s *natServer) parsePortsAndVPN(tokens []string) (string, string, string, error) {
+	var port, portEnd, vpn string
+
+	if s.protocol == "tcp" || s.protocol == "udp" {
+		if len(tokens) == 0 || !isPort(tokens[0]) {
+			return "", "", "", fmt.Errorf("缺少端口")
+		}
+		port = tokens[0]
+		tokens = tokens[1:]
+		if len(tokens) > 0 && isPort(tokens[0]) {
+			portEnd = tokens[0]
+			tokens = tokens[1:]
+		}
+	}
+
+	if len(tokens) >= 2 && tokens[0] == "vpn-instance" {
+		vpn = tokens[1]
+		tokens = tokens[2:]
+	}
+	if len(tokens) > 0 {
+		return "", "", "", fmt.Errorf("多余的参数: %s", strings.Join(tokens, " "))
+	}
+	return port, portEnd, vpn, nil
+}
+
+// parseAddress 解析 IP [结束IP]
+func parseAddress(tokens []string) (string, string, []string, error) {
+	if len(tokens) == 0 || net.ParseIP(tokens[0]) == nil {
+		return "", "", nil, fmt.Errorf("无效的IP地址")
+	}
+	ip := tokens[0]
+	tokens = tokens[1:]
+	if len(tokens) > 0 && net.ParseIP(tokens[0]) != nil {
+		return ip, tokens[0], tokens[1:], nil
+	}
+	return ip, "", tokens, nil
+}
+
+// isPort 判断是否为合法端口号
+func isPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port >= 0 && port <= 65535
+}
+
+// indexOf 返回token的位置，不存在时返回-1
+func indexOf(tokens []string, token string) int {
+	for i, t := range tokens {
+		if t == token {
+			return i
+		}
+	}
+	return -1
+}
+
+// display 按 display nat server 的格式输出
+func (s *natServer) display() []string {
+	protocol, ok := protocolNumbers[s.protocol]
+	if !ok {
+		protocol = s.protocol
+	}
+
+	global := endpoint(s.globalIP, s.globalIPEnd, s.globalPort, s.globalPortEnd)
+	switch {
+	case s.currentInterface:
+		global = "---(current-interface)/" + portText(s.globalPort, s.globalPortEnd)
+	case s.globalInterface != "":
+		global = "---/" + portText(s.globalPort, s.globalPortEnd)
+	}
+
+	lines := []string{
+		"  Interface: " + s.iface,
+		"    Protocol: " + protocol,
+		"    Global IP/port: " + global,
+	}
+	if s.globalInterface != "" {
+		lines = append(lines, "    Global interface: "+s.globalInterface)
+	}
+	lines = append(lines, "    Local IP/port : "+endpoint(s.localIP, s.localIPEnd, s.localPort, s.localPortEnd))
+	if s.globalVPN != "" {
+		lines = append(lines, "    Global VPN    : "+s.globalVPN)
+	}
+	if s.localVPN != "" {
+		lines = append(lines, "    Local VPN     : "+s.localVPN)
+	}
+	if s.acl != "" {
+		lines = append(lines, "    ACL           : "+s.acl)
+	}
+	if s.rule != "" {
+		lines = append(lines, "    Rule name     : "+s.rule)
+	}
+	if s.description != "" {
+		lines = append(lines, "    Description   : "+s.description)
+	}
+	return append(lines, "    Config status : Active")
+}
+
+// endpoint 格式化 IP[-IP]/端口[-端口]
+func endpoint(ip, ipEnd, port, portEnd string) string {
+	if ipEnd != "" {
+		ip += "-" + ipEnd
+	}
+	return ip + "/" + portText(port, portEnd)
+}
+
+// portText 格式化端口，没有端口时为 ---
+func portText(port, portEnd string) string {
+	if port == "" {
+		return "---"
+	}
+	if portEnd != "" {
+		return port + "-" + portEnd
+	}
+	return port
+}
+
+// conflicts 判断两条配置的外网地址端口是否冲突
+func (s *natServer) conflicts(other *natServer) bool {
+	// current-interface 是各自接口的地址，不同接口之间不冲突
+	if s.currentInterface && other.currentInterface && s.iface != other.iface {
+		return false
+	}
+	if s.key == other.key {
+		return true
+	}
+	if s.globalVPN != other.globalVPN || s.globalIP != other.globalIP ||
+		s.currentInterface != other.currentInterface || s.globalInterface != other.globalInterface {
+		return false
+	}
+	if s.protocol != other.protocol && s.protocol != "" && other.protocol != "" {
+		return false
+	}
+	if s.globalPort == "" || other.globalPort == "" {
+		return true
+	}
+	start, end := portRange(s.globalPort, s.globalPortEnd)
+	otherStart, otherEnd := portRange(other.globalPort, other.globalPortEnd)
+	return start <= otherEnd && otherStart <= end
+}
+
+// portRange 返回端口范围的起止
+func portRange(port, portEnd string) (int, int) {
+	start, _ := strconv.Atoi(port)
+	if portEnd == "" {
+		return start, start
+	}
+	end, _ := strconv.Atoi(portEnd)
+	return start, end
+}